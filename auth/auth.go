@@ -7,11 +7,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
+	"log"
 )
 
 // authentication cache file data
 type AuthData struct {
+	Version      int    `json:"version"`
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int    `json:"expires_in"`
@@ -20,16 +21,34 @@ type AuthData struct {
 	TokenType    string `json:"token_type"`
 }
 
-// read and return authentication data from a json file
+// read and return authentication data from a json file, upgrading a cache written by an older
+// version in place first
 func LoadAuthData() (AuthData, error) {
-	file, err := os.Open(AuthCacheFilePath())
+	if err := migrateOnUse(MigrateAuthCache); err != nil {
+		return AuthData{}, err
+	}
+	return ReadAuthData()
+}
+
+// read and return authentication data without ever writing to disk, for read-only callers such as
+// monitoring checks, an older cache is upgraded in memory only
+func ReadAuthData() (AuthData, error) {
+	data, err := ioutil.ReadFile(AuthCacheFilePath())
 	if err != nil {
 		return AuthData{}, fmt.Errorf("auth cache file not found or cannot be opened: %v", err)
 	}
-	defer file.Close()
+
+	doc, _, err := upgradeDoc(AuthCacheFilePath(), data, authCacheMigrations)
+	if err != nil {
+		return AuthData{}, err
+	}
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return AuthData{}, fmt.Errorf("error marshalling json: %v", err)
+	}
 
 	var auth AuthData
-	if err := json.NewDecoder(file).Decode(&auth); err != nil {
+	if err := json.Unmarshal(upgraded, &auth); err != nil {
 		return AuthData{}, fmt.Errorf("error decoding json from auth cache file: %v", err)
 	}
 	return auth, nil
@@ -37,6 +56,12 @@ func LoadAuthData() (AuthData, error) {
 
 // write the authentication data to a json file with restricted permissions
 func SaveAuthData(auth AuthData) error {
+	// keep a backup of a cache written by an older version before replacing it
+	if err := migrateOnUse(MigrateAuthCache); err != nil {
+		log.Printf("warning: %v", err)
+	}
+
+	auth.Version = AuthCacheVersion
 	authBytes, err := json.MarshalIndent(auth, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshalling json: %v", err)
@@ -0,0 +1,305 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	bundleFormat  = "tesla-config-bundle"
+	bundleVersion = 1
+
+	// scrypt parameters recommended for interactive use
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+var (
+	ErrBundlePassphrase = errors.New("bundle passphrase is incorrect or the bundle is corrupt")
+	ErrBundleFileExists = errors.New("file already exists")
+)
+
+// encrypted envelope written to disk
+type bundleEnvelope struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Kdf        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// plaintext bundle contents
+type bundlePayload struct {
+	CreatedAt string       `json:"created_at"`
+	Files     []BundleFile `json:"files"`
+}
+
+// a single file carried in a config bundle
+type BundleFile struct {
+	// path relative to the home directory, such as ~/.tesla/config.json
+	Path string `json:"path"`
+	Data []byte `json:"data"`
+}
+
+// collect the config, auth cache and private key files that make up the profile
+func bundleFiles() ([]BundleFile, error) {
+	paths := []string{configFilePath, authCacheFilePath}
+	if keyFile, err := GetKeyFile(); err == nil && keyFile != "" {
+		paths = append(paths, keyFile)
+	}
+
+	var files []BundleFile
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		rel, err := homeRelPath(path)
+		if err != nil {
+			return nil, err
+		}
+		if path == configFilePath {
+			if data, err = rewriteKeyFile(data, homeRelPath); err != nil {
+				return nil, err
+			}
+		}
+		files = append(files, BundleFile{Path: rel, Data: data})
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("nothing to export in %s", teslaCfgDirPath)
+	}
+	return files, nil
+}
+
+// express path relative to the home directory so bundles move between user accounts
+func homeRelPath(path string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(homeDir, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s is outside the home directory and cannot be bundled", path)
+	}
+	return filepath.Join("~", rel), nil
+}
+
+// expand a bundle path back to an absolute path below the home directory on this machine,
+// absolute paths and paths leaving the home directory are refused
+func homeAbsPath(path string) (string, error) {
+	rel, ok := strings.CutPrefix(path, "~"+string(filepath.Separator))
+	if !ok || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("bundle path must be below the home directory: %s", path)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, rel), nil
+}
+
+// rewrite the key file setting of a config file with convert, so the bundled config refers to
+// the key relative to the home directory and the restored one to the key on this machine
+func rewriteKeyFile(data []byte, convert func(string) (string, error)) ([]byte, error) {
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	keyName := strings.ToLower(teslaKeyFile)
+	keyFile, ok := config[keyName].(string)
+	if !ok || keyFile == "" {
+		return data, nil
+	}
+	converted, err := convert(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if converted == keyFile {
+		return data, nil
+	}
+	config[keyName] = converted
+	out, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config to JSON: %v", err)
+	}
+	return out, nil
+}
+
+// derive the bundle encryption key from a passphrase
+func bundleKey(passphrase string, salt []byte, n, r, p int) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("bundle passphrase must not be empty")
+	}
+	return scrypt.Key([]byte(passphrase), salt, n, r, p, scryptKeyLen)
+}
+
+// write the config, tokens and key material as a passphrase encrypted bundle
+func ExportBundle(w io.Writer, passphrase string) ([]BundleFile, error) {
+	files, err := bundleFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(bundlePayload{
+		CreatedAt: time.Now().Format(time.RFC3339),
+		Files:     files,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bundle: %v", err)
+	}
+
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	key, err := bundleKey(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newBundleCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	env := bundleEnvelope{
+		Format:     bundleFormat,
+		Version:    bundleVersion,
+		Kdf:        "scrypt",
+		N:          scryptN,
+		R:          scryptR,
+		P:          scryptP,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, []byte(bundleFormat)),
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(env); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %v", err)
+	}
+	return files, nil
+}
+
+// decrypt a bundle and restore its files, existing files are only replaced when force is set
+func ImportBundle(r io.Reader, passphrase string, force bool) ([]BundleFile, error) {
+	var env bundleEnvelope
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return nil, fmt.Errorf("error decoding bundle: %v", err)
+	}
+	if env.Format != bundleFormat || env.Kdf != "scrypt" {
+		return nil, fmt.Errorf("unrecognized bundle format: %s", env.Format)
+	}
+	if env.Version > bundleVersion {
+		return nil, fmt.Errorf("bundle version %d is newer than supported version %d", env.Version, bundleVersion)
+	}
+
+	key, err := bundleKey(passphrase, env.Salt, env.N, env.R, env.P)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newBundleCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, ErrBundlePassphrase
+	}
+
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, []byte(bundleFormat))
+	if err != nil {
+		return nil, ErrBundlePassphrase
+	}
+
+	var payload bundlePayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("error decoding bundle contents: %v", err)
+	}
+
+	// resolve and check every destination before touching the filesystem
+	dests := make([]string, len(payload.Files))
+	for i, f := range payload.Files {
+		dest, err := homeAbsPath(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(dest); err == nil && !force {
+			return nil, fmt.Errorf("%w: %s (use force to overwrite)", ErrBundleFileExists, dest)
+		}
+		if dest == configFilePath {
+			if payload.Files[i].Data, err = rewriteKeyFile(f.Data, homeAbsPath); err != nil {
+				return nil, err
+			}
+		}
+		dests[i] = dest
+	}
+
+	for i, f := range payload.Files {
+		if err := writePrivateFile(dests[i], f.Data); err != nil {
+			return nil, err
+		}
+		payload.Files[i].Path = dests[i]
+	}
+	return payload.Files, nil
+}
+
+func newBundleCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// write data with 0600 permissions, creating missing directories as 0700
+func writePrivateFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+	if dir == teslaCfgDirPath {
+		if err := EnsureFilePermissions(dir, 0700); err != nil {
+			return err
+		}
+	}
+	if err := EnsureFilePermissions(path, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
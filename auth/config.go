@@ -5,11 +5,17 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -18,9 +24,16 @@ const (
 	TokenEp  = "https://auth.tesla.com/oauth2/v3/token"
 	Audience = "https://fleet-api.prd.na.vn.cloud.tesla.com"
 
+	PairingEp = "https://tesla.com/_ak"
+
+	// client credentials (partner) tokens cannot be refreshed, so no offline_access
+	PartnerScope = "openid user_data vehicle_device_data vehicle_cmds vehicle_charging_cmds energy_device_data energy_cmds"
+
 	teslaCfgDir   = ".tesla"          // $HOME/.tesla
 	authCacheFile = "auth_cache.json" // $HOME/.tesla/auth_cache.json
 	configFile    = "config.json"     // $HOME/.tesla/config.json
+	sessionFile   = "sessions.json"   // $HOME/.tesla/sessions.json
+	vinCacheFile  = "vins.json"       // $HOME/.tesla/vins.json
 
 	// tesla environment variable names
 	teslaClientId     = "TESLA_CLIENT_ID"     // 00000000-0000-0000-0000-000000000000
@@ -28,12 +41,23 @@ const (
 	teslaKeyFile      = "TESLA_KEY_FILE"      // $HOME/.tesla/private.key
 	teslaVin          = "TESLA_VIN"           // 5YJ00000000000000
 	teslaRedirectUri  = "TESLA_REDIRECT_URI"  // https://auth.<yourdomain>.com/auth/callback
+	teslaAppDomain    = "TESLA_APP_DOMAIN"    // <yourdomain>.com
+	teslaUnits        = "TESLA_UNITS"         // metric or imperial
+	teslaGroups       = "TESLA_GROUPS"        // family=5YJ00000000000000,7SA00000000000000;work=...
+	teslaAliases      = "TESLA_ALIASES"       // blue-y=7SA00000000000000;red-3=5YJ00000000000000
+	teslaWake         = "TESLA_WAKE"          // allow=true,max-wait=60s,backoff=2s,jitter=0.2
+
+	// display units for vehicle state and temperatures
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
 )
 
 var (
 	teslaCfgDirPath   string
 	authCacheFilePath string
 	configFilePath    string
+	sessionFilePath   string
+	vinCacheFilePath  string
 )
 
 func init() {
@@ -50,6 +74,8 @@ func init() {
 
 	authCacheFilePath = filepath.Join(teslaCfgDirPath, authCacheFile)
 	configFilePath = filepath.Join(teslaCfgDirPath, configFile)
+	sessionFilePath = filepath.Join(teslaCfgDirPath, sessionFile)
+	vinCacheFilePath = filepath.Join(teslaCfgDirPath, vinCacheFile)
 }
 
 // path to the Tesla configuration directory
@@ -67,6 +93,11 @@ func ConfigFilePath() string {
 	return configFilePath
 }
 
+// path to the vehicle session cache
+func SessionFilePath() string {
+	return sessionFilePath
+}
+
 // prefer environment variables over config file
 func getConfigValue(varName string) (string, error) {
 	// environment has precedence
@@ -91,28 +122,73 @@ func readConfig() (map[string]string, error) {
 		return map[string]string{}, nil
 	}
 
+	// upgrade files written by older versions before reading them
+	if err := migrateOnUse(MigrateConfig); err != nil {
+		return nil, err
+	}
+
 	data, err := ioutil.ReadFile(configFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %v", err)
 	}
 
-	var config map[string]string
-	if err := json.Unmarshal(data, &config); err != nil {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %v", err)
 	}
+
+	// only string settings are exposed, the version field is handled by the migrations
+	config := make(map[string]string, len(doc))
+	for key, val := range doc {
+		if str, ok := val.(string); ok {
+			config[key] = str
+		}
+	}
 	return config, nil
 }
 
-// create config file from params
+// create config file from params, other settings already in the file are kept
 func WriteConfig(clientID, clientSecret, keyFile, vin, redirectURI string) error {
-	config := map[string]string{
-		strings.ToLower(teslaClientId):     clientID,
-		strings.ToLower(teslaClientSecret): clientSecret,
-		strings.ToLower(teslaKeyFile):      keyFile,
-		strings.ToLower(teslaVin):          vin,
-		strings.ToLower(teslaRedirectUri):  redirectURI,
+	config := map[string]interface{}{}
+	if existing, err := readConfig(); err == nil {
+		for key, val := range existing {
+			config[key] = val
+		}
+	}
+
+	config[strings.ToLower(teslaClientId)] = clientID
+	config[strings.ToLower(teslaClientSecret)] = clientSecret
+	config[strings.ToLower(teslaKeyFile)] = keyFile
+	config[strings.ToLower(teslaVin)] = vin
+	config[strings.ToLower(teslaRedirectUri)] = redirectURI
+
+	return writeConfig(config)
+}
+
+// update individual settings in the config file, other settings are kept
+func updateConfig(values map[string]string) error {
+	existing, err := readConfig()
+	if err != nil {
+		return err
 	}
+	config := make(map[string]interface{}, len(existing)+len(values))
+	for key, val := range existing {
+		config[key] = val
+	}
+	for key, val := range values {
+		config[strings.ToLower(key)] = val
+	}
+	return writeConfig(config)
+}
 
+// write config to the config file with owner-only permissions
+func writeConfig(config map[string]interface{}) error {
+	// keep a backup of a file written by an older version before replacing it
+	if err := migrateOnUse(MigrateConfig); err != nil {
+		log.Printf("warning: %v", err)
+	}
+
+	config[versionKey] = ConfigVersion
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config to JSON: %v", err)
@@ -168,7 +244,208 @@ func GetVin() (string, error) {
 	return getConfigValue(teslaVin)
 }
 
+// store vin as the default vehicle in the config file
+func SetVin(vin string) error {
+	if err := ValidateVin(vin); err != nil {
+		return err
+	}
+	if os.Getenv(teslaVin) != "" {
+		log.Printf("%s is set in the environment and overrides the config file", teslaVin)
+	}
+	return updateConfig(map[string]string{teslaVin: vin})
+}
+
 // tesla_redirect_uri environment variable
 func GetRedirectUri() (string, error) {
 	return getConfigValue(teslaRedirectUri)
 }
+
+// tesla_app_domain environment variable, falls back to the redirect uri host
+func GetAppDomain() (string, error) {
+	if domain, err := getConfigValue(teslaAppDomain); err == nil {
+		return domain, nil
+	}
+
+	redirectUri, err := GetRedirectUri()
+	if err != nil {
+		return "", fmt.Errorf("%s not found and no redirect uri to derive it from", teslaAppDomain)
+	}
+	u, err := url.Parse(redirectUri)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("cannot derive app domain from redirect uri %s", redirectUri)
+	}
+	return u.Hostname(), nil
+}
+
+// tesla_units environment variable, defaults to imperial
+func GetUnits() (string, error) {
+	units, err := getConfigValue(teslaUnits)
+	if err != nil {
+		return UnitsImperial, nil
+	}
+	units = strings.ToLower(units)
+	if err := ValidateUnits(units); err != nil {
+		return UnitsImperial, err
+	}
+	return units, nil
+}
+
+// store the display units in the config file
+func SetUnits(units string) error {
+	units = strings.ToLower(units)
+	if err := ValidateUnits(units); err != nil {
+		return err
+	}
+	if os.Getenv(teslaUnits) != "" {
+		log.Printf("%s is set in the environment and overrides the config file", teslaUnits)
+	}
+	return updateConfig(map[string]string{teslaUnits: units})
+}
+
+// tesla_aliases environment variable, short names for vehicles
+// format: name=vin;name=vin
+func GetAliases() (map[string]string, error) {
+	aliases := map[string]string{}
+	value, err := getConfigValue(teslaAliases)
+	if err != nil {
+		return aliases, nil // no aliases defined
+	}
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, vin, ok := strings.Cut(entry, "=")
+		name, vin = strings.TrimSpace(name), strings.TrimSpace(vin)
+		if !ok || name == "" || vin == "" {
+			return nil, fmt.Errorf("invalid %s entry: %s", teslaAliases, entry)
+		}
+		aliases[name] = vin
+	}
+	return aliases, nil
+}
+
+// store an alias for vin in the config file, an empty vin removes the alias
+func SetAlias(name, vin string) error {
+	if err := ValidateAlias(name); err != nil {
+		return err
+	}
+	if vin != "" {
+		if err := ValidateVin(vin); err != nil {
+			return err
+		}
+	}
+	if os.Getenv(teslaAliases) != "" {
+		log.Printf("%s is set in the environment and overrides the config file", teslaAliases)
+	}
+
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	aliases := map[string]string{}
+	for _, entry := range strings.Split(config[strings.ToLower(teslaAliases)], ";") {
+		if n, v, ok := strings.Cut(entry, "="); ok && strings.TrimSpace(n) != "" {
+			aliases[strings.TrimSpace(n)] = strings.TrimSpace(v)
+		}
+	}
+	if vin == "" {
+		delete(aliases, name)
+	} else {
+		aliases[name] = vin
+	}
+
+	names := make([]string, 0, len(aliases))
+	for n := range aliases {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	entries := make([]string, 0, len(names))
+	for _, n := range names {
+		entries = append(entries, n+"="+aliases[n])
+	}
+	return updateConfig(map[string]string{teslaAliases: strings.Join(entries, ";")})
+}
+
+// tesla_groups environment variable, named lists of vehicles
+// format: name=vin,vin;name=vin
+func GetGroups() (map[string][]string, error) {
+	groups := map[string][]string{}
+	value, err := getConfigValue(teslaGroups)
+	if err != nil {
+		return groups, nil // no groups defined
+	}
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, members, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid %s entry: %s", teslaGroups, entry)
+		}
+		for _, member := range strings.Split(members, ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				groups[name] = append(groups[name], member)
+			}
+		}
+		if len(groups[name]) == 0 {
+			return nil, fmt.Errorf("%s group %s has no vehicles", teslaGroups, name)
+		}
+	}
+	return groups, nil
+}
+
+// how commands wait for a sleeping vehicle to come online
+type WakePolicy struct {
+	Allow   bool          // send a wake up, otherwise commands to a sleeping vehicle fail
+	MaxWait time.Duration // give up if the vehicle is not online after this long
+	Backoff time.Duration // delay before the first state check, doubled after each check
+	Jitter  float64       // fraction of each delay that is randomized, 0 to 1
+}
+
+// wake policy used when tesla_wake leaves a field unset
+func DefaultWakePolicy() WakePolicy {
+	return WakePolicy{Allow: true, MaxWait: 60 * time.Second, Backoff: 2 * time.Second, Jitter: 0.2}
+}
+
+// tesla_wake environment variable, fields that are not listed keep their defaults
+// format: allow=true,max-wait=60s,backoff=2s,jitter=0.2
+func GetWakePolicy() (WakePolicy, error) {
+	policy := DefaultWakePolicy()
+	value, err := getConfigValue(teslaWake)
+	if err != nil {
+		return policy, nil // defaults
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(entry, "=")
+		if !ok {
+			return DefaultWakePolicy(), fmt.Errorf("invalid %s entry: %s", teslaWake, entry)
+		}
+		val = strings.TrimSpace(val)
+		switch strings.TrimSpace(name) {
+		case "allow":
+			policy.Allow, err = strconv.ParseBool(val)
+		case "max-wait":
+			policy.MaxWait, err = time.ParseDuration(val)
+		case "backoff":
+			policy.Backoff, err = time.ParseDuration(val)
+		case "jitter":
+			policy.Jitter, err = strconv.ParseFloat(val, 64)
+		default:
+			err = errors.New("unknown field")
+		}
+		if err != nil {
+			return DefaultWakePolicy(), fmt.Errorf("invalid %s entry %s: %v", teslaWake, entry, err)
+		}
+	}
+	if err := ValidateWakePolicy(policy); err != nil {
+		return DefaultWakePolicy(), fmt.Errorf("invalid %s: %v", teslaWake, err)
+	}
+	return policy, nil
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import "testing"
+
+func TestSetUnits(t *testing.T) {
+	useTempHome(t)
+	if err := WriteConfig(testClientId, testClientSecret, "/keys/private.key", "5YJ3E1EA7KF123456", "https://example.com/callback"); err != nil {
+		t.Fatal(err)
+	}
+	if units, _ := GetUnits(); units != UnitsImperial {
+		t.Errorf("default units: got %s, expected %s", units, UnitsImperial)
+	}
+
+	if err := SetUnits("Metric"); err != nil {
+		t.Fatal(err)
+	}
+	if units, err := GetUnits(); err != nil || units != UnitsMetric {
+		t.Errorf("got units %s (%v), expected %s", units, err, UnitsMetric)
+	}
+	if vin, _ := GetVin(); vin != "5YJ3E1EA7KF123456" {
+		t.Errorf("setting units lost the vin, got %q", vin)
+	}
+
+	// rewriting the credentials keeps the units
+	if err := WriteConfig(testClientId, testClientSecret, "/keys/private.key", "5YJ3E1EA7KF123456", "https://example.com/callback"); err != nil {
+		t.Fatal(err)
+	}
+	if units, _ := GetUnits(); units != UnitsMetric {
+		t.Errorf("WriteConfig lost the units, got %s", units)
+	}
+
+	if err := SetUnits("furlongs"); err == nil {
+		t.Error("accepted invalid units")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// pem encode the public half of a private key loaded with protocol.LoadPrivateKey
+func PublicKeyPEM(key protocol.ECDHPrivateKey) ([]byte, error) {
+	pub, err := ecdh.P256().NewPublicKey(key.PublicBytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert public key: %v", err)
+	}
+	return encodePublicKey(pub)
+}
+
+// pem encode a public key in pkix form
+func encodePublicKey(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// path of the public key file written next to a private key
+func PublicKeyPath(privPath string) string {
+	dir, base := filepath.Split(privPath)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	if strings.Contains(base, "private") {
+		base = strings.Replace(base, "private", "public", 1)
+	} else {
+		base += "-public"
+	}
+	return filepath.Join(dir, base+".pem")
+}
+
+// generate a NIST P-256 key pair, the private key is written to privPath and the
+// public key next to it, returns the public key path
+func GenerateKeyPair(privPath string) (string, error) {
+	if _, err := os.Stat(privPath); err == nil {
+		return "", fmt.Errorf("refusing to overwrite existing key file %s", privPath)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key: %v", err)
+	}
+	if err := writePrivateFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return "", err
+	}
+
+	pubPEM, err := encodePublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	pubPath := PublicKeyPath(privPath)
+	if err := os.WriteFile(pubPath, pubPEM, 0644); err != nil {
+		return "", fmt.Errorf("failed to write public key: %v", err)
+	}
+	return pubPath, nil
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// current schema versions of the files in the tesla config directory
+const (
+	ConfigVersion    = 1
+	AuthCacheVersion = 1
+
+	versionKey = "version"
+)
+
+// a single schema upgrade, applied to files older than version
+type migration struct {
+	version     int
+	description string
+	apply       func(doc map[string]interface{}) error
+}
+
+var configMigrations = []migration{
+	{
+		version:     1,
+		description: "add schema version field",
+		apply:       func(doc map[string]interface{}) error { return nil },
+	},
+}
+
+var authCacheMigrations = []migration{
+	{
+		version:     1,
+		description: "add schema version field",
+		apply:       func(doc map[string]interface{}) error { return nil },
+	},
+}
+
+// outcome of migrating one file
+type MigrationResult struct {
+	Path    string
+	From    int
+	To      int
+	Changes []string
+	Backup  string // empty for dry runs and up to date files
+	Missing bool
+}
+
+// true if the file was (or would be) changed
+func (r MigrationResult) Changed() bool {
+	return r.From != r.To
+}
+
+// serializes migrations within the process, lockFile serializes them across processes
+var migrateLock sync.Mutex
+
+// read the schema version of a decoded json document, unversioned files are version 0
+func docVersion(doc map[string]interface{}) (int, error) {
+	val, ok := doc[versionKey]
+	if !ok {
+		return 0, nil
+	}
+	num, ok := val.(float64)
+	if !ok || num < 0 || num != float64(int(num)) {
+		return 0, fmt.Errorf("invalid %s field: %v", versionKey, val)
+	}
+	return int(num), nil
+}
+
+// upgrade a decoded file to the latest schema version in memory, the file itself is not touched
+func upgradeDoc(path string, data []byte, migrations []migration) (map[string]interface{}, MigrationResult, error) {
+	latest := migrations[len(migrations)-1].version
+	result := MigrationResult{Path: path, To: latest}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, result, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	var err error
+	result.From, err = docVersion(doc)
+	if err != nil {
+		return nil, result, fmt.Errorf("%s: %v", path, err)
+	}
+	if result.From > latest {
+		return nil, result, fmt.Errorf("%s has version %d, newer than supported version %d", path, result.From, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= result.From {
+			continue
+		}
+		if err := m.apply(doc); err != nil {
+			return nil, result, fmt.Errorf("migration to version %d failed: %v", m.version, err)
+		}
+		doc[versionKey] = m.version
+		result.Changes = append(result.Changes, fmt.Sprintf("v%d: %s", m.version, m.description))
+	}
+	return doc, result, nil
+}
+
+// read the file at path and upgrade it in memory, a missing file is reported as up to date
+func readUpgraded(path string, migrations []migration) ([]byte, map[string]interface{}, MigrationResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		latest := migrations[len(migrations)-1].version
+		result := MigrationResult{Path: path, From: latest, To: latest}
+		if os.IsNotExist(err) {
+			result.Missing = true
+			return nil, nil, result, nil
+		}
+		return nil, nil, result, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	doc, result, err := upgradeDoc(path, data, migrations)
+	return data, doc, result, err
+}
+
+// upgrade an outdated file in place before it is read or replaced, so the original is kept as a
+// backup the first time a newer version uses it
+func migrateOnUse(migrate func(dryRun bool) (MigrationResult, error)) error {
+	result, err := migrate(false)
+	if err != nil {
+		return err
+	}
+	if result.Changed() {
+		log.Printf("migrated %s from version %d to %d, backup saved to %s", result.Path, result.From, result.To, result.Backup)
+	}
+	return nil
+}
+
+// upgrade the file at path to the latest schema version, keeping a backup of the original
+func migrateFile(path string, migrations []migration, dryRun bool) (MigrationResult, error) {
+	migrateLock.Lock()
+	defer migrateLock.Unlock()
+
+	_, _, result, err := readUpgraded(path, migrations)
+	if err != nil || !result.Changed() || dryRun {
+		return result, err
+	}
+
+	// another process may be migrating the same file, check again once it is done
+	unlock, err := lockFile(path, path)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+	data, doc, result, err := readUpgraded(path, migrations)
+	if err != nil || !result.Changed() {
+		return result, err
+	}
+
+	result.Backup = fmt.Sprintf("%s.v%d.bak", path, result.From)
+	if err := os.WriteFile(result.Backup, data, 0600); err != nil {
+		return result, fmt.Errorf("failed to write backup %s: %v", result.Backup, err)
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return result, fmt.Errorf("error marshalling json: %v", err)
+	}
+	if err := EnsureFilePermissions(path, 0600); err != nil {
+		return result, err
+	}
+	if err := os.WriteFile(path, out, 0600); err != nil {
+		return result, fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return result, nil
+}
+
+// upgrade the config file to the current schema version
+func MigrateConfig(dryRun bool) (MigrationResult, error) {
+	return migrateFile(configFilePath, configMigrations, dryRun)
+}
+
+// upgrade the auth cache file to the current schema version
+func MigrateAuthCache(dryRun bool) (MigrationResult, error) {
+	return migrateFile(authCacheFilePath, authCacheMigrations, dryRun)
+}
+
+// upgrade all files in the tesla config directory
+func MigrateAll(dryRun bool) ([]MigrationResult, error) {
+	var results []MigrationResult
+	for _, migrate := range []func(bool) (MigrationResult, error){MigrateConfig, MigrateAuthCache} {
+		result, err := migrate(dryRun)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
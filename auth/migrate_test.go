@@ -0,0 +1,158 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// files written before versioning have no version field
+const (
+	unversionedConfig    = `{"tesla_vin": "5YJ3E1EA7KF123456"}`
+	unversionedAuthCache = `{"access_token": "access", "refresh_token": "refresh"}`
+)
+
+func TestMigrateAll(t *testing.T) {
+	useTempHome(t)
+	writeTestFile(t, configFilePath, unversionedConfig)
+	writeTestFile(t, authCacheFilePath, unversionedAuthCache)
+	originals := map[string]string{configFilePath: unversionedConfig, authCacheFilePath: unversionedAuthCache}
+	latest := map[string]int{configFilePath: ConfigVersion, authCacheFilePath: AuthCacheVersion}
+
+	// a dry run reports the upgrade without writing
+	results, err := MigrateAll(true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	for _, r := range results {
+		if !r.Changed() || r.From != 0 || r.Backup != "" {
+			t.Errorf("dry run of %s: %+v", r.Path, r)
+		}
+		if data, _ := os.ReadFile(r.Path); string(data) != originals[r.Path] {
+			t.Errorf("dry run rewrote %s", r.Path)
+		}
+	}
+
+	results, err = MigrateAll(false)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, expected 2", len(results))
+	}
+	for _, r := range results {
+		if r.From != 0 || r.To != latest[r.Path] || len(r.Changes) == 0 {
+			t.Errorf("%s: %+v", r.Path, r)
+		}
+		if expected := r.Path + ".v0.bak"; r.Backup != expected {
+			t.Errorf("%s: backup %s, expected %s", r.Path, r.Backup, expected)
+		}
+		if backup, err := os.ReadFile(r.Backup); err != nil || string(backup) != originals[r.Path] {
+			t.Errorf("%s: backup holds %q (%v), expected the original", r.Path, backup, err)
+		}
+
+		data, err := os.ReadFile(r.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("%s: %v", r.Path, err)
+		}
+		if version, err := docVersion(doc); err != nil || version != latest[r.Path] {
+			t.Errorf("%s: version %d (%v), expected %d", r.Path, version, err, latest[r.Path])
+		}
+	}
+
+	// migrated files are left alone
+	results, err = MigrateAll(false)
+	if err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	for _, r := range results {
+		if r.Changed() || r.Backup != "" {
+			t.Errorf("second migrate of %s: %+v", r.Path, r)
+		}
+	}
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	useTempHome(t)
+	writeTestFile(t, configFilePath, `{"version": 99}`)
+	if _, err := MigrateConfig(false); err == nil {
+		t.Error("migrated a file newer than the supported version")
+	}
+	if _, err := readConfig(); err == nil {
+		t.Error("read a file newer than the supported version")
+	}
+}
+
+// the first read by a newer version upgrades the file in place and keeps the original as a backup
+func TestReadsMigrate(t *testing.T) {
+	useTempHome(t)
+	writeTestFile(t, configFilePath, unversionedConfig)
+	writeTestFile(t, authCacheFilePath, unversionedAuthCache)
+
+	// read-only loads leave the file alone
+	if authData, err := ReadAuthData(); err != nil || authData.Version != AuthCacheVersion {
+		t.Errorf("ReadAuthData: %+v (%v)", authData, err)
+	}
+	if data, _ := os.ReadFile(authCacheFilePath); string(data) != unversionedAuthCache {
+		t.Errorf("ReadAuthData rewrote %s", authCacheFilePath)
+	}
+
+	vin, err := GetVin()
+	if err != nil || vin != "5YJ3E1EA7KF123456" {
+		t.Errorf("GetVin: got %s (%v)", vin, err)
+	}
+	authData, err := LoadAuthData()
+	if err != nil {
+		t.Fatalf("LoadAuthData: %v", err)
+	}
+	if authData.Version != AuthCacheVersion || authData.AccessToken != "access" {
+		t.Errorf("LoadAuthData: %+v", authData)
+	}
+	checkMigrated(t, map[string]string{configFilePath: unversionedConfig, authCacheFilePath: unversionedAuthCache})
+}
+
+// replacing a file written by an older version keeps it as a backup
+func TestWritesKeepBackup(t *testing.T) {
+	useTempHome(t)
+	writeTestFile(t, configFilePath, unversionedConfig)
+	writeTestFile(t, authCacheFilePath, unversionedAuthCache)
+
+	if err := writeConfig(map[string]interface{}{"tesla_vin": "7SA00000000000000"}); err != nil {
+		t.Fatalf("writeConfig: %v", err)
+	}
+	if err := SaveAuthData(AuthData{AccessToken: "new"}); err != nil {
+		t.Fatalf("SaveAuthData: %v", err)
+	}
+	checkMigrated(t, map[string]string{configFilePath: unversionedConfig, authCacheFilePath: unversionedAuthCache})
+}
+
+// check each file is at the latest version and its unversioned original was backed up
+func checkMigrated(t *testing.T, originals map[string]string) {
+	t.Helper()
+	for path, original := range originals {
+		if backup, err := os.ReadFile(path + ".v0.bak"); err != nil || string(backup) != original {
+			t.Errorf("%s: backup holds %q (%v), expected the original", path, backup, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if version, err := docVersion(doc); err != nil || version == 0 {
+			t.Errorf("%s: version %d (%v), expected it to be upgraded", path, version, err)
+		}
+		if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+			t.Errorf("%s: lock file left behind", path)
+		}
+	}
+}
@@ -31,3 +31,12 @@ func GenOauthUrl(state string) (string, error) {
 	}
 	return fmt.Sprintf("%s?%s", AuthEp, params.Encode()), nil
 }
+
+// generate the virtual key pairing deep link for the app domain, opened on the phone with the tesla app
+func GenPairingUrl() (string, error) {
+	domain, err := GetAppDomain()
+	if err != nil {
+		return "", fmt.Errorf("failed to get app domain: %w", err)
+	}
+	return fmt.Sprintf("%s/%s", PairingEp, domain), nil
+}
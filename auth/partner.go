@@ -0,0 +1,169 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+const (
+	// where the fleet api expects the app public key on the app domain
+	PublicKeyWellKnownPath = "/.well-known/appspecific/com.tesla.3p.public-key.pem"
+
+	partnerAccountsEp = Audience + "/api/1/partner_accounts"
+)
+
+// fetch a partner token for the configured client id and secret
+func GetPartnerToken() (AuthData, error) {
+	clientId, err := GetClientId()
+	if err != nil {
+		return AuthData{}, err
+	}
+
+	clientSecret, err := GetClientSecret()
+	if err != nil {
+		return AuthData{}, err
+	}
+
+	return ClientCredentialsToken(clientId, clientSecret)
+}
+
+// derive the pem encoded app public key from the configured private key file
+func AppPublicKeyPEM() ([]byte, error) {
+	keyFile, err := GetKeyFile()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := protocol.LoadPrivateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return PublicKeyPEM(key)
+}
+
+// hex encoded uncompressed public key point, the form reported by the partner api
+func appPublicKeyHex() (string, error) {
+	keyFile, err := GetKeyFile()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := protocol.LoadPrivateKey(keyFile)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(key.PublicBytes()), nil
+}
+
+// write the app public key below webRoot at the well-known path, returns the file written
+func WritePublicKeyFile(webRoot string) (string, error) {
+	pemBytes, err := AppPublicKeyPEM()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(webRoot, filepath.FromSlash(PublicKeyWellKnownPath))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, pemBytes, 0644); err != nil {
+		return "", fmt.Errorf("failed to write public key: %v", err)
+	}
+	return path, nil
+}
+
+// http handler that serves the app public key at the well-known path
+func PublicKeyHandler() (http.Handler, error) {
+	pemBytes, err := AppPublicKeyPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(PublicKeyWellKnownPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Write(pemBytes)
+	})
+	return mux, nil
+}
+
+// send a partner api request and decode the response field of the reply
+func partnerRequest(method, endpoint, token string, body []byte, response interface{}) error {
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error constructing request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %v", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	envelope := struct {
+		Response interface{} `json:"response"`
+	}{Response: response}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("error decoding json: %v", err)
+	}
+	return nil
+}
+
+// register the app domain with the fleet api, the public key must already be served
+func RegisterPartnerAccount(token, domain string) error {
+	body, err := json.Marshal(map[string]string{"domain": domain})
+	if err != nil {
+		return fmt.Errorf("error marshalling json: %v", err)
+	}
+	var response json.RawMessage
+	return partnerRequest(http.MethodPost, partnerAccountsEp, token, body, &response)
+}
+
+// read back the public key registered for domain, hex encoded
+func GetPartnerPublicKey(token, domain string) (string, error) {
+	var response struct {
+		PublicKey string `json:"public_key"`
+	}
+	endpoint := partnerAccountsEp + "/public_key?" + url.Values{"domain": {domain}}.Encode()
+	if err := partnerRequest(http.MethodGet, endpoint, token, nil, &response); err != nil {
+		return "", err
+	}
+	return response.PublicKey, nil
+}
+
+// confirm the key registered for domain matches the configured private key
+func VerifyPartnerPublicKey(token, domain string) (bool, error) {
+	registered, err := GetPartnerPublicKey(token, domain)
+	if err != nil {
+		return false, err
+	}
+	local, err := appPublicKeyHex()
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(registered, local), nil
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+const (
+	testClientId     = "01234567-89ab-cdef-0123-456789abcdef"
+	testClientSecret = "secret"
+)
+
+// send every request made through http.DefaultClient to handler, whatever its host
+func useTestServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := http.DefaultClient.Transport
+	t.Cleanup(func() { http.DefaultClient.Transport = transport })
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// generate a private key in a temporary home and configure it as the app key
+func useTestKey(t *testing.T) string {
+	t.Helper()
+	useTempHome(t)
+	keyFile := filepath.Join(teslaCfgDirPath, "private.key")
+	if _, err := GenerateKeyPair(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(teslaKeyFile, keyFile)
+	return keyFile
+}
+
+func TestGetPartnerToken(t *testing.T) {
+	useTempHome(t)
+	t.Setenv(teslaClientId, testClientId)
+	t.Setenv(teslaClientSecret, testClientSecret)
+
+	var form url.Values
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/oauth2/v3/token" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		form = r.PostForm
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "partner", "expires_in": 28800, "token_type": "Bearer"})
+	})
+
+	token, err := GetPartnerToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "partner" || token.CapturedAt == "" {
+		t.Errorf("unexpected token %+v", token)
+	}
+	expected := map[string]string{
+		"grant_type":    "client_credentials",
+		"client_id":     testClientId,
+		"client_secret": testClientSecret,
+		"scope":         PartnerScope,
+		"audience":      Audience,
+	}
+	for name, value := range expected {
+		if got := form.Get(name); got != value {
+			t.Errorf("form field %s: got %q, expected %q", name, got, value)
+		}
+	}
+	if strings.Contains(form.Get("scope"), "offline_access") {
+		t.Error("partner token requested offline_access")
+	}
+}
+
+func TestRegisterPartnerAccountError(t *testing.T) {
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer partner" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"domain":"example.com"}` {
+			t.Errorf("unexpected body %s", body)
+		}
+		http.Error(w, `{"error":"public key not found at https://example.com/.well-known"}`, http.StatusBadRequest)
+	})
+
+	err := RegisterPartnerAccount("partner", "example.com")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, part := range []string{"400", "public key not found"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("error %q does not mention %q", err, part)
+		}
+	}
+}
+
+func TestVerifyPartnerPublicKey(t *testing.T) {
+	keyFile := useTestKey(t)
+	key, err := protocol.LoadPrivateKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := hex.EncodeToString(key.PublicBytes())
+	other := "04" + strings.Repeat("ab", 64)
+
+	registered := local
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/partner_accounts/public_key" || r.URL.Query().Get("domain") != "example.com" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"response": map[string]string{"public_key": registered}})
+	})
+
+	for _, test := range []struct {
+		registered string
+		match      bool
+	}{
+		{local, true},
+		{strings.ToUpper(local), true},
+		{other, false},
+	} {
+		registered = test.registered
+		match, err := VerifyPartnerPublicKey("partner", "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match != test.match {
+			t.Errorf("registered key %s: got match %t, expected %t", test.registered, match, test.match)
+		}
+	}
+}
+
+func TestPublicKeyHandler(t *testing.T) {
+	useTestKey(t)
+	expected, err := AppPublicKeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := PublicKeyHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, PublicKeyWellKnownPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/x-pem-file" {
+		t.Errorf("got content type %q", contentType)
+	}
+	if w.Body.String() != string(expected) || !strings.HasPrefix(w.Body.String(), "-----BEGIN PUBLIC KEY-----") {
+		t.Errorf("got body %q, expected %q", w.Body.String(), expected)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/private.key", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("other paths: got status %d, expected %d", w.Code, http.StatusNotFound)
+	}
+}
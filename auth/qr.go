@@ -0,0 +1,77 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+const qrQuietZone = 4 // modules of blank border required around the code
+
+// qr code styles, named for the terminal background they suit
+const (
+	QRDark  = "dark"  // light modules drawn as blocks, the default
+	QRLight = "light" // dark modules drawn as blocks
+)
+
+// true when the TESLA_QR environment variable asks for links to be shown as qr codes
+func QRRequested() bool {
+	val := os.Getenv("TESLA_QR")
+	return val != "" && val != "false" && val != "0"
+}
+
+// qr code style for the terminal, TESLA_QR=light selects codes for light backgrounds
+func QRStyle() string {
+	if strings.ToLower(os.Getenv("TESLA_QR")) == QRLight {
+		return QRLight
+	}
+	return QRDark
+}
+
+// render text as a qr code in the style selected by TESLA_QR
+func RenderQR(text string) (string, error) {
+	return RenderQRStyle(text, QRStyle())
+}
+
+// render text as a qr code for the terminal using unicode half blocks, each character
+// holds two vertically stacked modules. blocks are drawn in the terminal's text colour,
+// so for QRDark the light modules and quiet zone are drawn as blocks and dark modules
+// as blanks, and for QRLight the other way around
+func RenderQRStyle(text, style string) (string, error) {
+	if style != QRDark && style != QRLight {
+		return "", fmt.Errorf("unknown qr code style: %s", style)
+	}
+	code, err := qr.Encode(text, qr.L)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode qr code: %v", err)
+	}
+
+	filled := func(x, y int) bool {
+		// outside the code is the quiet zone, which is light
+		return code.Black(x, y) == (style == QRLight)
+	}
+
+	var sb strings.Builder
+	for y := -qrQuietZone; y < code.Size+qrQuietZone; y += 2 {
+		for x := -qrQuietZone; x < code.Size+qrQuietZone; x++ {
+			top, bottom := filled(x, y), filled(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteRune('█')
+			case top:
+				sb.WriteRune('▀')
+			case bottom:
+				sb.WriteRune('▄')
+			default:
+				sb.WriteRune(' ')
+			}
+		}
+		sb.WriteRune('\n')
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"rsc.io/qr"
+)
+
+// read the modules back from a rendered code, true where a block is drawn
+func renderedModules(t *testing.T, rendered string) [][]bool {
+	t.Helper()
+	var rows [][]bool
+	for _, line := range strings.Split(strings.TrimSuffix(rendered, "\n"), "\n") {
+		var top, bottom []bool
+		for _, c := range line {
+			switch c {
+			case '█':
+				top, bottom = append(top, true), append(bottom, true)
+			case '▀':
+				top, bottom = append(top, true), append(bottom, false)
+			case '▄':
+				top, bottom = append(top, false), append(bottom, true)
+			case ' ':
+				top, bottom = append(top, false), append(bottom, false)
+			default:
+				t.Fatalf("unexpected character %q", c)
+			}
+		}
+		rows = append(rows, top, bottom)
+	}
+	return rows
+}
+
+func TestRenderQRStyle(t *testing.T) {
+	const text = "https://tesla.com/_ak/example.com"
+	code, err := qr.Encode(text, qr.L)
+	if err != nil {
+		t.Fatal(err)
+	}
+	width := code.Size + 2*qrQuietZone
+
+	for _, style := range []string{QRDark, QRLight} {
+		rendered, err := RenderQRStyle(text, style)
+		if err != nil {
+			t.Fatalf("%s: %v", style, err)
+		}
+		rows := renderedModules(t, rendered)
+		if expected := (width + 1) / 2; len(rows)/2 != expected {
+			t.Errorf("%s: %d lines, expected %d", style, len(rows)/2, expected)
+		}
+
+		// light modules are blocks on dark terminals and blanks on light ones
+		lightDrawn := style == QRDark
+		for y := 0; y < width; y++ {
+			if len(rows[y]) != width {
+				t.Fatalf("%s: row %d is %d modules wide, expected %d", style, y, len(rows[y]), width)
+			}
+			for x := 0; x < width; x++ {
+				cx, cy := x-qrQuietZone, y-qrQuietZone
+				quiet := cx < 0 || cy < 0 || cx >= code.Size || cy >= code.Size
+				light := !code.Black(cx, cy)
+				if quiet && !light {
+					t.Fatalf("%s: dark module in the quiet zone at %d,%d", style, x, y)
+				}
+				if rows[y][x] != (light == lightDrawn) {
+					t.Fatalf("%s: module %d,%d does not match the code", style, x, y)
+				}
+			}
+		}
+	}
+
+	if _, err := RenderQRStyle(text, "sepia"); err == nil {
+		t.Error("accepted an unknown style")
+	}
+}
+
+func TestQRStyle(t *testing.T) {
+	for value, expected := range map[string]string{"": QRDark, "1": QRDark, "light": QRLight, "LIGHT": QRLight, "dark": QRDark} {
+		t.Setenv("TESLA_QR", value)
+		if style := QRStyle(); style != expected {
+			t.Errorf("TESLA_QR=%s: got %s, expected %s", value, style, expected)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+const (
+	sessionLockWait  = 5 * time.Second  // give up waiting for another process after this long
+	sessionLockStale = 30 * time.Second // a lock older than this was left behind by a crashed process
+)
+
+// load the vehicle sessions saved by earlier runs, a missing or unreadable cache starts out empty
+//
+// passing the cache to account.GetVehicle lets the vehicle resume its sessions without a handshake,
+// if the vehicle rejects a cached session the client resynchronizes with it and carries on
+func LoadSessionCache() *cache.SessionCache {
+	unlock, err := lockSessionFile()
+	if err != nil {
+		log.Printf("warning: %v, starting without cached sessions", err)
+		return cache.New(0)
+	}
+	defer unlock()
+
+	sessions, err := cache.ImportFromFile(sessionFilePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("warning: ignoring session cache %s: %v", sessionFilePath, err)
+		}
+		return cache.New(0)
+	}
+	if sessions.Vehicles == nil {
+		return cache.New(0)
+	}
+	return sessions
+}
+
+// save the sessions of car, merging them with what other processes saved since the cache was loaded,
+// a vehicle without sessions leaves the cache untouched
+func SaveSessionCache(car *vehicle.Vehicle) error {
+	current := cache.New(0)
+	if err := car.UpdateCachedSessions(current); err != nil {
+		return fmt.Errorf("failed to export sessions: %v", err)
+	}
+	if entries, _ := current.GetEntry(car.VIN()); len(entries) == 0 {
+		return nil
+	}
+
+	unlock, err := lockSessionFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sessions, err := cache.ImportFromFile(sessionFilePath)
+	if err != nil || sessions.Vehicles == nil {
+		sessions = cache.New(0)
+	}
+	if err := car.UpdateCachedSessions(sessions); err != nil {
+		return fmt.Errorf("failed to update session cache: %v", err)
+	}
+
+	// write a temporary file and rename it so readers never see a partial cache
+	tmp, err := os.CreateTemp(teslaCfgDirPath, sessionFile+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create session cache: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set session cache permissions: %v", err)
+	}
+	if err := sessions.Export(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session cache: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session cache: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), sessionFilePath); err != nil {
+		return fmt.Errorf("failed to write session cache: %v", err)
+	}
+	return nil
+}
+
+// take the session cache lock shared by all processes using this profile
+func lockSessionFile() (func(), error) {
+	return lockFile(sessionFilePath, "session cache")
+}
+
+// take a lock on the file at path shared by all processes using this profile, what names the file
+// in errors
+//
+// the lock is a file created exclusively next to the locked file, portable to every platform the
+// tools build on, a lock file left behind by a crashed process is removed once it is stale
+func lockFile(path, what string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(sessionLockWait)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock %s: %v", what, err)
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > sessionLockStale {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another process, remove %s if it is not", what, lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -6,9 +6,11 @@ package auth
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -60,6 +62,36 @@ func GetAuthToken(code string) (AuthData, error) {
 	return authData, nil
 }
 
+// fetch a partner token using the client credentials grant, also verifies the client id and secret
+func ClientCredentialsToken(clientId, clientSecret string) (AuthData, error) {
+	data := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientId},
+		"client_secret": {clientSecret},
+		"scope":         {PartnerScope},
+		"audience":      {Audience},
+	}
+
+	resp, err := http.PostForm(TokenEp, data)
+	if err != nil {
+		return AuthData{}, fmt.Errorf("failed to get partner token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return AuthData{}, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var authData AuthData
+	if err := json.NewDecoder(resp.Body).Decode(&authData); err != nil {
+		return AuthData{}, fmt.Errorf("error decoding json: %v", err)
+	}
+
+	authData.CapturedAt = time.Now().Format(time.RFC3339)
+	return authData, nil
+}
+
 // refresh the auth token using the provided token
 func RefreshAuthToken(refreshToken string) (AuthData, error) {
 	clientId, err := GetClientId()
@@ -87,6 +119,27 @@ func RefreshAuthToken(refreshToken string) (AuthData, error) {
 	return authData, nil
 }
 
+// time the tokens were issued, the refresh token is replaced on every refresh so this is also its age
+func TokenCapturedAt(authData AuthData) (time.Time, error) {
+	if authData.CapturedAt == "" {
+		return time.Time{}, fmt.Errorf("captured_at is missing")
+	}
+	capturedTime, err := time.Parse(time.RFC3339, authData.CapturedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse captured time: %v", err)
+	}
+	return capturedTime, nil
+}
+
+// time the access token expires
+func TokenExpiresAt(authData AuthData) (time.Time, error) {
+	capturedTime, err := TokenCapturedAt(authData)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return capturedTime.Add(time.Duration(authData.ExpiresIn) * time.Second), nil
+}
+
 // calculates the remaining life of the token with fallbacks
 func CalculateTokenLifePercentage(authData AuthData) int {
 	if authData.CapturedAt == "" {
@@ -0,0 +1,113 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+var (
+	clientIdRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	vinRegex      = regexp.MustCompile(`^[A-HJ-NPR-Z0-9]{17}$`) // no I, O or Q
+)
+
+// client id is the uuid issued by the tesla developer portal
+func ValidateClientId(clientId string) error {
+	if !clientIdRegex.MatchString(clientId) {
+		return errors.New("client id must be a uuid (00000000-0000-0000-0000-000000000000)")
+	}
+	return nil
+}
+
+// client secret is opaque but must be present and free of whitespace
+func ValidateClientSecret(clientSecret string) error {
+	if clientSecret == "" {
+		return errors.New("client secret must not be empty")
+	}
+	if strings.ContainsAny(clientSecret, " \t\r\n") {
+		return errors.New("client secret must not contain whitespace")
+	}
+	return nil
+}
+
+// key file must hold a NIST P-256 private key
+func ValidateKeyFile(keyFile string) error {
+	if keyFile == "" {
+		return errors.New("key file path must not be empty")
+	}
+	_, err := protocol.LoadPrivateKey(keyFile)
+	return err
+}
+
+// vin is 17 characters, letters I, O and Q are never used
+func ValidateVin(vin string) error {
+	if !vinRegex.MatchString(vin) {
+		return errors.New("vin must be 17 characters of A-Z and 0-9, excluding I, O and Q")
+	}
+	return nil
+}
+
+// alias is a short vehicle name usable in place of a vin
+func ValidateAlias(alias string) error {
+	switch {
+	case alias == "":
+		return errors.New("alias must not be empty")
+	case strings.EqualFold(alias, "all"):
+		return errors.New("alias must not be 'all'")
+	case strings.ContainsAny(alias, ",;= \t"):
+		return errors.New("alias must not contain commas, semicolons, equals signs or whitespace")
+	case vinRegex.MatchString(strings.ToUpper(alias)):
+		return errors.New("alias must not look like a vin")
+	}
+	return nil
+}
+
+// redirect uri must be an absolute https url, http is only allowed for localhost
+func ValidateRedirectUri(redirectUri string) error {
+	u, err := url.Parse(redirectUri)
+	if err != nil {
+		return fmt.Errorf("invalid redirect uri: %v", err)
+	}
+	if u.Host == "" {
+		return errors.New("redirect uri must be an absolute url")
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if host := u.Hostname(); host != "localhost" && host != "127.0.0.1" {
+			return errors.New("redirect uri must use https unless it points at localhost")
+		}
+	default:
+		return errors.New("redirect uri must use https")
+	}
+	return nil
+}
+
+// units is the display preference, metric or imperial
+func ValidateUnits(units string) error {
+	switch strings.ToLower(units) {
+	case UnitsMetric, UnitsImperial:
+		return nil
+	}
+	return fmt.Errorf("units must be %s or %s, not '%s'", UnitsMetric, UnitsImperial, units)
+}
+
+// wake waits must be positive and the jitter a fraction of the delay
+func ValidateWakePolicy(policy WakePolicy) error {
+	switch {
+	case policy.MaxWait <= 0:
+		return fmt.Errorf("wake max wait must be positive, not %s", policy.MaxWait)
+	case policy.Backoff <= 0:
+		return fmt.Errorf("wake backoff must be positive, not %s", policy.Backoff)
+	case policy.Jitter < 0 || policy.Jitter > 1:
+		return fmt.Errorf("wake jitter must be between 0 and 1, not %g", policy.Jitter)
+	}
+	return nil
+}
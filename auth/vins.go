@@ -0,0 +1,65 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// vins on the account as of the last vehicle listing, kept so completion never has to ask the api
+type vinCache struct {
+	Vins      []string `json:"vins"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// remember the vins on the account, replacing the previous list
+func SaveAccountVins(vins []string) error {
+	cache := vinCache{Vins: make([]string, 0, len(vins)), UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
+	for _, vin := range vins {
+		cache.Vins = append(cache.Vins, strings.ToUpper(vin))
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal vin cache to JSON: %v", err)
+	}
+
+	// write a temporary file and rename it so a completing shell never sees a partial list
+	tmp, err := os.CreateTemp(teslaCfgDirPath, vinCacheFile+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create vin cache: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write vin cache: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write vin cache: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), vinCacheFilePath); err != nil {
+		return fmt.Errorf("failed to write vin cache: %v", err)
+	}
+	return nil
+}
+
+// vins saved by the last vehicle listing, empty if the vehicles were never listed
+func LoadAccountVins() ([]string, error) {
+	data, err := os.ReadFile(vinCacheFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read vin cache: %v", err)
+	}
+
+	var cache vinCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("failed to parse vin cache: %v", err)
+	}
+	return cache.Vins, nil
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2025, John Clark <inindev@gmail.com>
+//
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAccountVins(t *testing.T) {
+	useTempHome(t)
+	if vins, err := LoadAccountVins(); err != nil || len(vins) != 0 {
+		t.Fatalf("before listing: got %v (%v), expected none", vins, err)
+	}
+
+	if err := SaveAccountVins([]string{"5yj3e1ea7kf123456", "7SA00000000000000"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAccountVins([]string{"5yj3e1ea7kf123456", "7SAYGDEE1PF000001"}); err != nil {
+		t.Fatal(err)
+	}
+	vins, err := LoadAccountVins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"5YJ3E1EA7KF123456", "7SAYGDEE1PF000001"}; !reflect.DeepEqual(vins, expected) {
+		t.Errorf("got %v, expected %v", vins, expected)
+	}
+}
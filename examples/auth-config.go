@@ -5,47 +5,187 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/inindev/tesla_utils/auth"
+	"golang.org/x/term"
 )
 
+// one configuration value collected by the wizard
+type field struct {
+	label    string
+	value    *string
+	secret   bool
+	validate func(string) error
+}
+
+var (
+	reader      = bufio.NewReader(os.Stdin)
+	interactive = term.IsTerminal(int(os.Stdin.Fd()))
+)
+
+// prompt for a value, secrets are read without echo
+func prompt(f field) (string, error) {
+	current := *f.value
+	switch {
+	case current == "":
+		fmt.Printf("%s: ", f.label)
+	case f.secret:
+		fmt.Printf("%s [keep current]: ", f.label)
+	default:
+		fmt.Printf("%s [%s]: ", f.label, current)
+	}
+
+	var input string
+	if f.secret && interactive {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		input = string(b)
+	} else {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		input = line
+	}
+
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return current, nil
+	}
+	return input, nil
+}
+
+// ask a yes/no question, an empty answer selects def
+func confirm(question string, def bool) bool {
+	hint := "[y/N]"
+	if def {
+		hint = "[Y/n]"
+	}
+	fmt.Printf("%s %s: ", question, hint)
+	line, _ := reader.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// validate the key file, offering to generate a new key pair if it does not exist
+func checkKeyFile(keyFile string, generate, nonInteractive bool) error {
+	if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+		if !generate && !nonInteractive {
+			generate = confirm(fmt.Sprintf("%s does not exist, generate a new P-256 key pair?", keyFile), true)
+		}
+		if !generate {
+			return fmt.Errorf("key file %s does not exist (use -generate-key to create it)", keyFile)
+		}
+		pubPath, err := auth.GenerateKeyPair(keyFile)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("generated private key %s\n", keyFile)
+		fmt.Printf("generated public key %s\n", pubPath)
+		return nil
+	} else if generate {
+		return fmt.Errorf("refusing to overwrite existing key file %s", keyFile)
+	}
+	return auth.ValidateKeyFile(keyFile)
+}
+
 func main() {
-	reader := bufio.NewReader(os.Stdin)
+	var (
+		clientId       string
+		clientSecret   string
+		keyFile        string
+		vin            string
+		redirectUri    string
+		units          string
+		generateKey    bool
+		skipVerify     bool
+		nonInteractive bool
+	)
+
+	// existing values (environment or config file) become the defaults
+	clientId, _ = auth.GetClientId()
+	clientSecret, _ = auth.GetClientSecret()
+	keyFile, _ = auth.GetKeyFile()
+	vin, _ = auth.GetVin()
+	redirectUri, _ = auth.GetRedirectUri()
+	units, _ = auth.GetUnits()
+	if keyFile == "" {
+		keyFile = filepath.Join(auth.TeslaCfgDirPath(), "private.key")
+	}
 
-	// Get client ID
-	fmt.Print("Enter Tesla Client ID: ")
-	clientId, _ := reader.ReadString('\n')
-	clientId = strings.TrimSpace(clientId)
+	flag.StringVar(&clientId, "client-id", clientId, "Tesla client id")
+	flag.StringVar(&clientSecret, "client-secret", clientSecret, "Tesla client secret (prefer TESLA_CLIENT_SECRET, flags are visible to other users)")
+	flag.StringVar(&keyFile, "key-file", keyFile, "path to the P-256 private key")
+	flag.StringVar(&vin, "vin", vin, "vehicle identification number")
+	flag.StringVar(&redirectUri, "redirect-uri", redirectUri, "OAuth redirect uri")
+	flag.StringVar(&units, "units", units, "display units, metric or imperial")
+	flag.BoolVar(&generateKey, "generate-key", false, "generate a new P-256 key pair at -key-file")
+	flag.BoolVar(&skipVerify, "skip-verify", false, "do not test the client id and secret against the token endpoint")
+	flag.BoolVar(&nonInteractive, "non-interactive", false, "never prompt, fail on missing or invalid values")
+	flag.Parse()
 
-	// Get client secret
-	fmt.Print("Enter Tesla Client Secret: ")
-	clientSecret, _ := reader.ReadString('\n')
-	clientSecret = strings.TrimSpace(clientSecret)
+	fields := []field{
+		{label: "Tesla Client ID", value: &clientId, validate: auth.ValidateClientId},
+		{label: "Tesla Client Secret", value: &clientSecret, secret: true, validate: auth.ValidateClientSecret},
+		{label: "Tesla Key File Path", value: &keyFile, validate: func(s string) error {
+			return checkKeyFile(s, generateKey, nonInteractive)
+		}},
+		{label: "Tesla VIN", value: &vin, validate: auth.ValidateVin},
+		{label: "Tesla Redirect URI", value: &redirectUri, validate: auth.ValidateRedirectUri},
+		{label: "Units (metric or imperial)", value: &units, validate: auth.ValidateUnits},
+	}
 
-	// Get key file path
-	fmt.Print("Enter Tesla Key File Path: ")
-	keyFile, _ := reader.ReadString('\n')
-	keyFile = strings.TrimSpace(keyFile)
+	for _, f := range fields {
+		for {
+			if !nonInteractive {
+				val, err := prompt(f)
+				if err != nil {
+					log.Fatalf("failed to read %s: %v", f.label, err)
+				}
+				*f.value = val
+			}
 
-	// Get VIN
-	fmt.Print("Enter Tesla VIN: ")
-	vin, _ := reader.ReadString('\n')
-	vin = strings.TrimSpace(vin)
+			err := f.validate(*f.value)
+			if err == nil {
+				break
+			}
+			if nonInteractive {
+				log.Fatalf("invalid %s: %v", f.label, err)
+			}
+			fmt.Printf("invalid %s: %v\n", f.label, err)
+		}
+	}
 
-	// Get redirect URI
-	fmt.Print("Enter Tesla Redirect URI: ")
-	redirectURI, _ := reader.ReadString('\n')
-	redirectURI = strings.TrimSpace(redirectURI)
+	if !skipVerify {
+		fmt.Println("verifying client credentials...")
+		if _, err := auth.ClientCredentialsToken(clientId, clientSecret); err != nil {
+			log.Fatalf("client id and secret were rejected by the token endpoint: %v", err)
+		}
+		fmt.Println("client credentials verified")
+	}
 
 	// Write configuration
-	err := auth.WriteConfig(clientId, clientSecret, keyFile, vin, redirectURI)
+	err := auth.WriteConfig(clientId, clientSecret, keyFile, vin, redirectUri)
 	if err != nil {
 		log.Fatalf("Failed to write config: %v", err)
 	}
+	if err := auth.SetUnits(units); err != nil {
+		log.Fatalf("Failed to write config: %v", err)
+	}
 
 	fmt.Println("Configuration successfully written to config.json.")
 }
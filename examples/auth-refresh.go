@@ -4,11 +4,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/inindev/tesla_utils/auth"
 )
@@ -19,7 +21,99 @@ import (
 //  4 - failed to save auth data
 //  5 - failed to manage the token
 //  6 - for any error other than "file does not exist" when checking the auth cache file
-//  7 - failed to generate the oauth url
+//  7 - failed to generate the oauth or pairing url
+
+// check mode exit codes (nagios plugin convention)
+const (
+	checkOk       = 0
+	checkWarning  = 1
+	checkCritical = 2
+	checkUnknown  = 3
+)
+
+var checkStatusNames = map[int]string{
+	checkOk:       "OK",
+	checkWarning:  "WARNING",
+	checkCritical: "CRITICAL",
+	checkUnknown:  "UNKNOWN",
+}
+
+// check thresholds
+type thresholds struct {
+	warnLife    int // remaining access token life in percent
+	critLife    int
+	warnAgeDays int // refresh token age in days
+	critAgeDays int
+}
+
+// reject thresholds that leave a warning state unreachable
+func (t thresholds) validate() error {
+	if t.warnLife <= t.critLife {
+		return fmt.Errorf("-warn-life %d must be above -crit-life %d", t.warnLife, t.critLife)
+	}
+	if t.warnAgeDays >= t.critAgeDays {
+		return fmt.Errorf("-warn-refresh-age %d must be below -crit-refresh-age %d", t.warnAgeDays, t.critAgeDays)
+	}
+	return nil
+}
+
+// print one nagios style status line with perfdata and return the exit code, never prompts or refreshes
+func checkToken(t thresholds) int {
+	status := checkOk
+	raise := func(s int) {
+		if s > status {
+			status = s
+		}
+	}
+
+	if err := t.validate(); err != nil {
+		fmt.Printf("AUTH %s - %v\n", checkStatusNames[checkUnknown], err)
+		return checkUnknown
+	}
+
+	// a probe must never modify the cache, not even to migrate it
+	authData, err := auth.ReadAuthData()
+	if err != nil {
+		fmt.Printf("AUTH %s - %v\n", checkStatusNames[checkCritical], err)
+		return checkCritical
+	}
+
+	capturedAt, err := auth.TokenCapturedAt(authData)
+	if err != nil {
+		fmt.Printf("AUTH %s - %v\n", checkStatusNames[checkUnknown], err)
+		return checkUnknown
+	}
+	expiresAt, _ := auth.TokenExpiresAt(authData)
+
+	now := time.Now()
+	life := auth.CalculateTokenLifePercentage(authData)
+	remaining := expiresAt.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	age := now.Sub(capturedAt)
+	ageDays := int(age.Hours() / 24)
+
+	switch {
+	case life <= t.critLife:
+		raise(checkCritical)
+	case life <= t.warnLife:
+		raise(checkWarning)
+	}
+	switch {
+	case ageDays >= t.critAgeDays:
+		raise(checkCritical)
+	case ageDays >= t.warnAgeDays:
+		raise(checkWarning)
+	}
+
+	fmt.Printf("AUTH %s - access token life %d%% (%s left), refresh token age %dd | life_pct=%d%%;%d;%d;0;100 remaining_s=%d refresh_age_s=%d;%d;%d\n",
+		checkStatusNames[status], life, remaining.Round(time.Second), ageDays,
+		life, t.warnLife, t.critLife,
+		int64(remaining.Seconds()),
+		int64(age.Seconds()), t.warnAgeDays*86400, t.critAgeDays*86400)
+	return status
+}
 
 func handleAuthCommand(code string) {
 	authResponse, err := auth.GetAuthToken(code)
@@ -37,10 +131,42 @@ func handleAuthCommand(code string) {
 }
 
 func main() {
-	if len(os.Args) > 1 {
+	var (
+		check  bool
+		pair   bool
+		showQR bool
+		t      thresholds
+	)
+	flag.BoolVar(&check, "check", false, "report token health for monitoring and exit 0 (ok), 1 (warning), 2 (critical) or 3 (unknown)")
+	flag.IntVar(&t.warnLife, "warn-life", 30, "warn when remaining access token life is at or below this percentage")
+	flag.IntVar(&t.critLife, "crit-life", 10, "critical when remaining access token life is at or below this percentage")
+	flag.IntVar(&t.warnAgeDays, "warn-refresh-age", 60, "warn when the refresh token is at least this many days old")
+	flag.IntVar(&t.critAgeDays, "crit-refresh-age", 80, "critical when the refresh token is at least this many days old")
+	flag.BoolVar(&showQR, "qr", auth.QRRequested(), "also show the oauth url as a qr code (or set TESLA_QR, TESLA_QR=light for light terminals)")
+	flag.BoolVar(&pair, "pair", false, "show the virtual key pairing link for the app domain as a qr code")
+	flag.Parse()
+
+	if check {
+		os.Exit(checkToken(t))
+	}
+
+	if pair {
+		pairingUrl, err := auth.GenPairingUrl()
+		if err != nil {
+			log.Printf("failed to generate pairing url: %v", err)
+			os.Exit(7)
+		}
+		fmt.Printf("\nopen on the phone with the tesla app to pair the virtual key\n\n%s\n\n", pairingUrl)
+		if code, err := auth.RenderQR(pairingUrl); err == nil {
+			fmt.Println(code)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 {
 		const tokenPattern = "^NA_[a-fA-F0-9]{60}$"
 		tokenRegex := regexp.MustCompile(tokenPattern)
-		token := os.Args[1]
+		token := flag.Arg(0)
 		if !tokenRegex.MatchString(token) {
 			log.Printf("token '%s' appears corrupt\n", token)
 			os.Exit(2) // Exit with a specific code for corrupt token
@@ -71,4 +197,9 @@ func main() {
 
 	fmt.Printf("\npaste into browser to generate a new NA_xxx auth token\n")
 	fmt.Printf("\n%s\n%s\n%s\n\n", state, strings.Repeat("~", len(state)), oauthUrl)
+	if showQR {
+		if code, err := auth.RenderQR(oauthUrl); err == nil {
+			fmt.Println(code)
+		}
+	}
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseArgs matches values to the command's arguments and validates each one against its type.
+// Enum and boolean values are replaced with their canonical spelling. No network activity takes
+// place, so callers can reject bad input before connecting to the vehicle.
+func (c *Command) parseArgs(values []string) (map[string]string, error) {
+	if len(values) < len(c.args) || len(values) > len(c.args)+len(c.optional) {
+		return nil, fmt.Errorf("%w: got %d arguments (%d required, %d optional)", ErrCommandLineArgs, len(values), len(c.args), len(c.optional))
+	}
+	keywords := make(map[string]string)
+	all := append(append([]Argument{}, c.args...), c.optional...)
+	for i, value := range values {
+		arg := all[i]
+		canonical, err := arg.validate(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s '%s': %s", ErrCommandLineArgs, arg.name, value, err)
+		}
+		keywords[arg.name] = canonical
+	}
+	return keywords, nil
+}
+
+// positional orders named argument values the way parseArgs expects them. Optional arguments may
+// only be given if every optional argument before them is also given.
+func (c *Command) positional(named map[string]string) ([]string, error) {
+	var values []string
+	seen := 0
+	all := append(append([]Argument{}, c.args...), c.optional...)
+	for i, arg := range all {
+		value, ok := named[arg.name]
+		if !ok {
+			if i < len(c.args) {
+				return nil, fmt.Errorf("%w: missing %s", ErrCommandLineArgs, arg.name)
+			}
+			break
+		}
+		values = append(values, value)
+		seen++
+	}
+	if seen != len(named) {
+		for name := range named {
+			if !c.hasArgument(name) {
+				return nil, fmt.Errorf("%w: unknown argument %s", ErrCommandLineArgs, name)
+			}
+		}
+		return nil, fmt.Errorf("%w: optional arguments must be given in order", ErrCommandLineArgs)
+	}
+	return values, nil
+}
+
+func (c *Command) hasArgument(name string) bool {
+	for _, arg := range append(append([]Argument{}, c.args...), c.optional...) {
+		if arg.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRange is true if the argument declares bounds.
+func (a Argument) hasRange() bool {
+	return a.max > a.min
+}
+
+func (a Argument) checkRange(v float64) error {
+	if a.hasRange() && (v < a.min || v > a.max) {
+		return fmt.Errorf("must be between %g and %g", a.min, a.max)
+	}
+	return nil
+}
+
+// validate checks value against the argument's type and returns its canonical form.
+func (a Argument) validate(value string) (string, error) {
+	switch a.typ {
+	case argInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", errors.New("expected an integer")
+		}
+		return value, a.checkRange(float64(n))
+	case argFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", errors.New("expected a number")
+		}
+		return value, a.checkRange(f)
+	case argPercent:
+		n, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+		if err != nil {
+			return "", errors.New("expected a whole percentage")
+		}
+		if !a.hasRange() && (n < 0 || n > 100) {
+			return "", errors.New("must be between 0 and 100")
+		}
+		return strconv.Itoa(n), a.checkRange(float64(n))
+	case argEnum, argBool:
+		for _, allowed := range a.enum {
+			if strings.EqualFold(value, allowed) {
+				return allowed, nil
+			}
+		}
+		return "", fmt.Errorf("expected one of %s", strings.Join(a.enum, ", "))
+	case argDuration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return "", errors.New("expected a duration such as 2h or 10m")
+		}
+		if d < 0 {
+			return "", errors.New("must not be negative")
+		}
+	case argTime:
+		if _, err := MinutesAfterMidnight(value); err != nil {
+			return "", err
+		}
+	case argTimeRange:
+		ends := strings.Split(value, "-")
+		if len(ends) != 2 || ends[0] == "" && ends[1] == "" {
+			return "", errors.New("expected START-END, START- or -END")
+		}
+		for _, end := range ends {
+			if end == "" {
+				continue
+			}
+			if _, err := MinutesAfterMidnight(end); err != nil {
+				return "", err
+			}
+		}
+	case argDays:
+		if _, err := GetDays(value); err != nil {
+			return "", err
+		}
+	case argLatitude, argLongitude:
+		deg, err := GetDegree(value)
+		if err != nil {
+			return "", err
+		}
+		if a.typ == argLatitude && (deg < -90 || deg > 90) {
+			return "", errors.New("latitude must be in the range [-90, 90]")
+		}
+	case argTemp:
+		celsius, err := parseTemp(value)
+		if err != nil {
+			return "", errors.New("expected a temperature such as 22C or 72F")
+		}
+		if a.hasRange() && (float64(celsius) < a.min || float64(celsius) > a.max) {
+			return "", fmt.Errorf("must be between %s and %s", formatTemp(float32(a.min)), formatTemp(float32(a.max)))
+		}
+	case argFile:
+		if _, err := os.Stat(value); err != nil {
+			return "", errors.New("file not found")
+		}
+	}
+	return value, nil
+}
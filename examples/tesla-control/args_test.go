@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	testCases := []struct {
+		command string
+		args    []string
+		name    string // argument to check
+		value   string // expected canonical value
+		err     error
+	}{
+		{command: "charging-set-limit", args: []string{"80"}, name: "PERCENT", value: "80"},
+		{command: "charging-set-limit", args: []string{"800"}, err: ErrCommandLineArgs},
+		{command: "charging-set-limit", args: []string{"eighty"}, err: ErrCommandLineArgs},
+		{command: "charging-set-limit", args: nil, err: ErrCommandLineArgs},
+		{command: "sentry-mode", args: []string{"ON"}, name: "STATE", value: "on"},
+		{command: "sentry-mode", args: []string{"maybe"}, err: ErrCommandLineArgs},
+		{command: "seat-heater", args: []string{"front-left", "warm"}, err: ErrCommandLineArgs},
+		{command: "state", args: []string{"Charge"}, name: "CATEGORY", value: "charge"},
+		{command: "software-update-start", args: []string{"2h"}, name: "DELAY", value: "2h"},
+		{command: "software-update-start", args: []string{"soon"}, err: ErrCommandLineArgs},
+		{command: "charging-schedule-add", args: []string{"mon,fri", "22:00-6:00", "37.4", "-122.1"}, name: "TIME", value: "22:00-6:00"},
+		{command: "charging-schedule-add", args: []string{"mon,fri", "22:00-25:00", "37.4", "-122.1"}, err: ErrCommandLineArgs},
+		{command: "charging-schedule-add", args: []string{"someday", "22:00-6:00", "37.4", "-122.1"}, err: ErrCommandLineArgs},
+		{command: "precondition-schedule-add", args: []string{"all", "7:30", "97.4", "-122.1"}, err: ErrCommandLineArgs},
+		{command: "climate-set-temp", args: []string{"21c"}, name: "TEMP", value: "21c"},
+		{command: "climate-set-temp", args: []string{"100c"}, err: ErrCommandLineArgs},
+		{command: "add-key", args: []string{"/no/such/key.pem", "owner", "cloud_key"}, err: ErrCommandLineArgs},
+	}
+	for _, test := range testCases {
+		keywords, err := commands[test.command].parseArgs(test.args)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s %q: expected error %v, got %v", test.command, test.args, test.err, err)
+		} else if test.name != "" && keywords[test.name] != test.value {
+			t.Errorf("%s %q: expected %s = '%s', got '%s'", test.command, test.args, test.name, test.value, keywords[test.name])
+		}
+	}
+}
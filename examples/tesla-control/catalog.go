@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// argType describes the value an Argument accepts.
+type argType string
+
+const (
+	argString    argType = "string"
+	argInt       argType = "int"
+	argFloat     argType = "float"
+	argPercent   argType = "percent"
+	argEnum      argType = "enum"
+	argBool      argType = "bool"
+	argDuration  argType = "duration"   // Go duration, e.g. 2h or 10m
+	argTime      argType = "time"       // HH:MM, 24-hour clock
+	argTimeRange argType = "time-range" // [HH:MM]-[HH:MM]
+	argDays      argType = "days"       // comma-separated day names
+	argLatitude  argType = "latitude"
+	argLongitude argType = "longitude"
+	argTemp      argType = "temperature" // number with optional C or F suffix
+	argFile      argType = "file"
+)
+
+// Catalogue version, increased when fields are removed or change meaning.
+const catalogueVersion = 1
+
+// catalogue is the machine-readable description of all commands, printed by `commands --json`.
+type catalogue struct {
+	Version  int                `json:"version"`
+	Commands []catalogueCommand `json:"commands"`
+}
+
+type catalogueCommand struct {
+	Name             string              `json:"name"`
+	Help             string              `json:"help"`
+	Transport        string              `json:"transport"`
+	RequiresAuth     bool                `json:"requires_auth"`
+	RequiresFleetAPI bool                `json:"requires_fleet_api"`
+	Domain           string              `json:"domain,omitempty"`
+	Endpoint         string              `json:"endpoint,omitempty"`
+	Idempotent       bool                `json:"idempotent"`
+	Args             []catalogueArgument `json:"args"`
+}
+
+type catalogueArgument struct {
+	Name     string   `json:"name"`
+	Help     string   `json:"help"`
+	Type     argType  `json:"type"`
+	Enum     []string `json:"enum,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Optional bool     `json:"optional"`
+}
+
+// transport names how a command reaches its target.
+func (c *Command) transport() string {
+	switch {
+	case c.local:
+		return "local"
+	case c.requiresFleetAPI:
+		return "fleet-api"
+	}
+	return "vehicle"
+}
+
+func domainName(domain protocol.Domain) string {
+	switch domain {
+	case protocol.DomainVCSEC:
+		return "vcsec"
+	case protocol.DomainInfotainment:
+		return "infotainment"
+	}
+	return ""
+}
+
+func (a Argument) catalogueEntry(optional bool) catalogueArgument {
+	typ := a.typ
+	if typ == "" {
+		typ = argString
+	}
+	entry := catalogueArgument{Name: a.name, Help: a.help, Type: typ, Enum: a.enum, Optional: optional}
+	if a.hasRange() {
+		min, max := a.min, a.max
+		entry.Min, entry.Max = &min, &max
+	}
+	return entry
+}
+
+// buildCatalogue describes every command in the commands map, sorted by name.
+func buildCatalogue() catalogue {
+	names := sortedNames(commands)
+	cat := catalogue{Version: catalogueVersion, Commands: make([]catalogueCommand, 0, len(names))}
+	for _, name := range names {
+		info := commands[name]
+		entry := catalogueCommand{
+			Name:             name,
+			Help:             info.help,
+			Transport:        info.transport(),
+			RequiresAuth:     info.requiresAuth,
+			RequiresFleetAPI: info.requiresFleetAPI,
+			Domain:           domainName(info.domain),
+			Endpoint:         info.endpoint,
+			Idempotent:       info.idempotent,
+			Args:             []catalogueArgument{},
+		}
+		for _, arg := range info.args {
+			entry.Args = append(entry.Args, arg.catalogueEntry(false))
+		}
+		for _, arg := range info.optional {
+			entry.Args = append(entry.Args, arg.catalogueEntry(true))
+		}
+		cat.Commands = append(cat.Commands, entry)
+	}
+	return cat
+}
+
+// signature formats a command's arguments the way Usage does, e.g. "TYPE [ ID ]".
+func (c *Command) signature() string {
+	var parts []string
+	for _, arg := range c.args {
+		parts = append(parts, arg.name)
+	}
+	if len(c.optional) > 0 {
+		parts = append(parts, "[")
+		for _, arg := range c.optional {
+			parts = append(parts, arg.name)
+		}
+		parts = append(parts, "]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// listCommands responds with the command catalogue. With format --json the text form is the
+// catalogue itself; otherwise it is one line per command.
+func listCommands(ctx context.Context, format string) error {
+	cat := buildCatalogue()
+	switch strings.TrimLeft(format, "-") {
+	case "json":
+		data, err := json.MarshalIndent(cat, "", "  ")
+		if err != nil {
+			return err
+		}
+		respond(ctx, cat, string(data))
+		return nil
+	case "":
+	default:
+		return fmt.Errorf("%w: unsupported FORMAT '%s'", ErrCommandLineArgs, format)
+	}
+
+	lines := make([]string, 0, len(cat.Commands))
+	for _, entry := range cat.Commands {
+		lines = append(lines, strings.TrimSpace(entry.Name+" "+commands[entry.Name].signature()))
+	}
+	respond(ctx, cat, strings.Join(lines, "\n"))
+	return nil
+}
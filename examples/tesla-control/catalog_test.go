@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCatalogue(t *testing.T) {
+	cat := buildCatalogue()
+	if len(cat.Commands) != len(commands) {
+		t.Fatalf("catalogue has %d commands, expected %d", len(cat.Commands), len(commands))
+	}
+	for _, entry := range cat.Commands {
+		for _, arg := range entry.Args {
+			if (arg.Type == argEnum || arg.Type == argBool) && len(arg.Enum) == 0 {
+				t.Errorf("%s %s is an %s without allowed values", entry.Name, arg.Name, arg.Type)
+			}
+		}
+		if commands[entry.Name].handler == nil {
+			t.Errorf("%s has no handler", entry.Name)
+		}
+	}
+	if _, err := json.Marshal(cat); err != nil {
+		t.Errorf("failed to encode catalogue: %s", err)
+	}
+}
+
+func TestCatalogueEndpoint(t *testing.T) {
+	for _, entry := range buildCatalogue().Commands {
+		if entry.Name != "get-vehicle-data" {
+			continue
+		}
+		if entry.Endpoint != "api/1/vehicles/{vin}/vehicle_data" || entry.Transport != "fleet-api" {
+			t.Errorf("unexpected catalogue entry for get-vehicle-data: %+v", entry)
+		}
+		return
+	}
+	t.Error("get-vehicle-data missing from catalogue")
+}
+
+func TestCatalogueTransport(t *testing.T) {
+	expected := map[string]string{
+		"help":             "local",
+		"exit":             "local",
+		"commands":         "local",
+		"completion":       "local",
+		"pairing-link":     "local",
+		"honk":             "vehicle",
+		"get-vehicle-data": "fleet-api",
+	}
+	for _, entry := range buildCatalogue().Commands {
+		if transport, ok := expected[entry.Name]; ok && entry.Transport != transport {
+			t.Errorf("%s: got transport %s, expected %s", entry.Name, entry.Transport, transport)
+		}
+		if entry.Transport == "local" && (entry.RequiresAuth || entry.RequiresFleetAPI || entry.Domain != "") {
+			t.Errorf("%s is local but needs a connection: %+v", entry.Name, entry)
+		}
+	}
+}
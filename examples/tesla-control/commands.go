@@ -48,6 +48,10 @@ var (
 type Argument struct {
 	name string
 	help string
+	typ  argType  // Value type, checked by parseArgs; empty means argString
+	enum []string // Allowed values for argEnum and argBool, or allowed items for argDays
+	min  float64  // Bounds for numeric and temperature (Celsius) arguments, checked if max > min
+	max  float64
 }
 
 type Handler func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error
@@ -60,6 +64,9 @@ type Command struct {
 	optional         []Argument
 	handler          Handler
 	domain           protocol.Domain
+	endpoint         string // Fleet API endpoint the handler requests, for the catalogue; {vin} stands for the VIN
+	local            bool   // True if command runs without a vehicle or account
+	idempotent       bool   // True if sending the command twice has the same effect as sending it once
 }
 
 var categoriesByName = map[string]vehicle.StateCategory{
@@ -77,14 +84,37 @@ var categoriesByName = map[string]vehicle.StateCategory{
 	"parental-controls":     vehicle.StateCategoryParentalControls,
 }
 
-func categoryNames() []string {
-	var names []string
-	for name, _ := range categoriesByName {
+// See SeatPosition definition for controlling backrest heaters (limited models).
+var seatPositions = map[string]vehicle.SeatPosition{
+	"front-left":     vehicle.SeatFrontLeft,
+	"front-right":    vehicle.SeatFrontRight,
+	"2nd-row-left":   vehicle.SeatSecondRowLeft,
+	"2nd-row-center": vehicle.SeatSecondRowCenter,
+	"2nd-row-right":  vehicle.SeatSecondRowRight,
+	"3rd-row-left":   vehicle.SeatThirdRowLeft,
+	"3rd-row-right":  vehicle.SeatThirdRowRight,
+}
+
+var (
+	keyRoles       = []string{"owner", "driver", "fm", "vehicle_monitor", "charging_manager"}
+	keyFormFactors = []string{"nfc_card", "ios_device", "android_device", "cloud_key"}
+	onOffValues    = []string{"on", "off"}
+)
+
+// sortedNames returns the keys of m in sorted order.
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
+func categoryNames() []string {
+	return sortedNames(categoriesByName)
+}
+
 func GetCategory(nameStr string) (vehicle.StateCategory, error) {
 	if category, ok := categoriesByName[strings.ToLower(nameStr)]; ok {
 		return category, nil
@@ -103,6 +133,15 @@ func GetDegree(degStr string) (float32, error) {
 	return float32(deg), nil
 }
 
+// dayNames lists the day names accepted by GetDays.
+func dayNames() []string {
+	names := sortedNames(dayNamesBitMask)
+	for i, name := range names {
+		names[i] = strings.ToLower(name)
+	}
+	return names
+}
+
 func GetDays(days string) (int32, error) {
 	var mask int32
 	for _, d := range strings.Split(days, ",") {
@@ -195,10 +234,12 @@ func checkReadiness(commandName string, havePrivateKey, haveOAuth, haveVIN bool)
 		if !haveOAuth {
 			return nil, ErrRequiresOAuth
 		}
+		// Fleet API endpoints under a vehicle target it by VIN, the rest target the account.
+		if strings.Contains(info.endpoint, "{vin}") && !haveVIN {
+			return nil, ErrRequiresVIN
+		}
 	} else {
-		// Currently, commands supported by this application either target the account (and
-		// therefore require FleetAPI credentials but not a VIN) or target a vehicle (and therefore
-		// require a VIN but not FleetAPI credentials).
+		// Commands that do not use the Fleet API target a vehicle, and therefore require a VIN.
 		if !haveVIN {
 			return nil, ErrRequiresVIN
 		}
@@ -223,47 +264,45 @@ func execute(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, a
 		return nil
 	}
 
-	info, err := checkReadiness(args[0], car != nil && car.PrivateKeyAvailable(), acct != nil, car != nil)
-	if err != nil {
-		return err
+	if dryRunMode {
+		return dryRun(ctx, args)
 	}
 
-	// authenticate if the command requires fleet api
-	if info.requiresFleetAPI {
-		authData, err := authenticate()
-		if err != nil {
-			return fmt.Errorf("authentication failed: %w", err)
-		}
-
-		// refresh or create account with new token if necessary
-		clientId, _ := auth.GetClientId()
-		acct, err = account.New(authData.AccessToken, clientId)
+	var err error
+	info, ok := commands[args[0]]
+	if !ok || !info.local {
+		info, err = checkReadiness(args[0], car != nil && car.PrivateKeyAvailable(), acct != nil, car != nil)
 		if err != nil {
-			return fmt.Errorf("account creation failed: %w", err)
+			return err
 		}
 	}
 
-	if len(args)-1 < len(info.args) || len(args)-1 > len(info.args)+len(info.optional) {
-		writeErr("Invalid number of command line arguments: %d (%d required, %d optional).", len(args), len(info.args), len(info.optional))
-		err = ErrCommandLineArgs
-	} else {
-		keywords := make(map[string]string)
-		for i, argInfo := range info.args {
-			keywords[argInfo.name] = args[i+1]
+	keywords, err := info.parseArgs(args[1:])
+	if err == nil {
+		if r := resultFromContext(ctx); r != nil {
+			r.Args = keywords
 		}
-		index := len(info.args) + 1
-		for _, argInfo := range info.optional {
-			if index >= len(args) {
-				break
+
+		// authenticate if the command requires fleet api
+		if info.requiresFleetAPI {
+			authData, err := authenticate()
+			if err != nil {
+				return fmt.Errorf("authentication failed: %w", err)
+			}
+
+			// refresh or create account with new token if necessary
+			clientId, _ := auth.GetClientId()
+			acct, err = account.New(authData.AccessToken, clientId)
+			if err != nil {
+				return fmt.Errorf("account creation failed: %w", err)
 			}
-			keywords[argInfo.name] = args[index]
-			index++
 		}
+
 		err = info.handler(ctx, acct, car, keywords)
 	}
 
 	// Print command-specific help
-	if errors.Is(err, ErrCommandLineArgs) {
+	if errors.Is(err, ErrCommandLineArgs) && outputMode == outputText {
 		info.Usage(args[0])
 	}
 	return err
@@ -307,7 +346,9 @@ func init() {
 		"valet-mode-on": &Command{
 			help:             "Enable valet mode",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
 				Argument{name: "PIN", help: "Valet mode PIN"},
 			},
@@ -318,7 +359,9 @@ func init() {
 		"valet-mode-off": &Command{
 			help:             "Disable valet mode",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.DisableValetMode(ctx)
 			},
@@ -326,7 +369,9 @@ func init() {
 		"unlock": &Command{
 			help:             "Unlock vehicle",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.Unlock(ctx)
 			},
@@ -334,7 +379,9 @@ func init() {
 		"lock": &Command{
 			help:             "Lock vehicle",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.Lock(ctx)
 			},
@@ -342,6 +389,7 @@ func init() {
 		"drive": &Command{
 			help:             "Remote start vehicle",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.RemoteDrive(ctx)
@@ -350,7 +398,9 @@ func init() {
 		"climate-on": &Command{
 			help:             "Turn on climate control",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.ClimateOn(ctx)
 			},
@@ -358,28 +408,26 @@ func init() {
 		"climate-off": &Command{
 			help:             "Turn off climate control",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.ClimateOff(ctx)
 			},
 		},
 		"climate-set-temp": &Command{
-			help:             "Set temperature (Celsius)",
+			help:             "Set temperature",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "TEMP", help: "Desired temperature (e.g., 70f or 21c; defaults to Celsius)"},
+				Argument{name: "TEMP", help: "Desired temperature (e.g., 70f or 21c; defaults to -units)", typ: argTemp, min: 15, max: 28},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-				var degrees float32
-				var unit string
-				if _, err := fmt.Sscanf(args["TEMP"], "%f%s", &degrees, &unit); err != nil {
-					return fmt.Errorf("failed to parse temperature: format as 22C or 72F")
-				}
-				if unit == "F" || unit == "f" {
-					degrees = (degrees - 32.0) * 5.0 / 9.0
-				} else if unit != "C" && unit != "c" {
-					return fmt.Errorf("temperature units must be C or F")
+				degrees, err := parseTemp(args["TEMP"])
+				if err != nil {
+					return err
 				}
 				return car.ChangeClimateTemp(ctx, degrees, degrees)
 			},
@@ -387,11 +435,13 @@ func init() {
 		"add-key": &Command{
 			help:             "Add PUBLIC_KEY to vehicle whitelist with ROLE and FORM_FACTOR",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)"},
-				Argument{name: "ROLE", help: "One of: owner, driver, fm (fleet manager), vehicle_monitor, charging_manager"},
-				Argument{name: "FORM_FACTOR", help: "One of: nfc_card, ios_device, android_device, cloud_key"},
+				Argument{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)", typ: argFile},
+				Argument{name: "ROLE", help: "One of: owner, driver, fm (fleet manager), vehicle_monitor, charging_manager", typ: argEnum, enum: keyRoles},
+				Argument{name: "FORM_FACTOR", help: "One of: nfc_card, ios_device, android_device, cloud_key", typ: argEnum, enum: keyFormFactors},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				role, ok := keys.Role_value["ROLE_"+strings.ToUpper(args["ROLE"])]
@@ -412,11 +462,12 @@ func init() {
 		"add-key-request": &Command{
 			help:             "Request NFC-card approval for a enrolling PUBLIC_KEY with ROLE and FORM_FACTOR",
 			requiresAuth:     false,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
 			args: []Argument{
-				Argument{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)"},
-				Argument{name: "ROLE", help: "One of: owner, driver, fm (fleet manager), vehicle_monitor, charging_manager"},
-				Argument{name: "FORM_FACTOR", help: "One of: nfc_card, ios_device, android_device, cloud_key"},
+				Argument{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)", typ: argFile},
+				Argument{name: "ROLE", help: "One of: owner, driver, fm (fleet manager), vehicle_monitor, charging_manager", typ: argEnum, enum: keyRoles},
+				Argument{name: "FORM_FACTOR", help: "One of: nfc_card, ios_device, android_device, cloud_key", typ: argEnum, enum: keyFormFactors},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				role, ok := keys.Role_value["ROLE_"+strings.ToUpper(args["ROLE"])]
@@ -434,16 +485,19 @@ func init() {
 				if err := car.SendAddKeyRequestWithRole(ctx, publicKey, keys.Role(role), vcsec.KeyFormFactor(formFactor)); err != nil {
 					return err
 				}
-				fmt.Printf("Sent add-key request to %s. Confirm by tapping NFC card on center console.\n", car.VIN())
+				respond(ctx, map[string]string{"vin": car.VIN(), "status": "sent"},
+					fmt.Sprintf("Sent add-key request to %s. Confirm by tapping NFC card on center console.", car.VIN()))
 				return nil
 			},
 		},
 		"remove-key": &Command{
 			help:             "Remove PUBLIC_KEY from vehicle whitelist",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)"},
+				Argument{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)", typ: argFile},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				publicKey, err := protocol.LoadPublicKey(args["PUBLIC_KEY"])
@@ -457,8 +511,9 @@ func init() {
 			help:             "Change the human-readable metadata of PUBLIC_KEY to NAME, MODEL, KIND",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)"},
+				Argument{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)", typ: argFile},
 				Argument{name: "NAME", help: "New human-readable name for the public key (e.g., Dave's Phone)"},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
@@ -469,10 +524,29 @@ func init() {
 				return acct.UpdateKey(ctx, publicKey, args["NAME"])
 			},
 		},
+		"pairing-link": &Command{
+			help:             "Show the virtual key pairing link for the configured app domain. Scan it with the phone that has the Tesla app.",
+			requiresAuth:     false,
+			requiresFleetAPI: false,
+			local:            true,
+			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+				link, err := auth.GenPairingUrl()
+				if err != nil {
+					return err
+				}
+				code, err := auth.RenderQR(link)
+				if err != nil {
+					return err
+				}
+				respond(ctx, map[string]string{"url": link}, link+"\n"+code)
+				return nil
+			},
+		},
 		"get": &Command{
 			help:             "GET an owner API http ENDPOINT. Hostname will be taken from -config.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
 			args: []Argument{
 				Argument{name: "ENDPOINT", help: "Fleet API endpoint"},
 			},
@@ -481,7 +555,7 @@ func init() {
 				if err != nil {
 					return err
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -489,6 +563,8 @@ func init() {
 			help:             "Retrieve drivers associated with the vehicle from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/vehicles/{vin}/drivers",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -500,7 +576,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching drivers for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -508,6 +584,8 @@ func init() {
 			help:             "Retrieve eligible subscriptions for the vehicle from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/dx/vehicles/subscriptions/eligibility?vin={vin}",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -519,7 +597,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching eligible subscriptions for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -527,6 +605,8 @@ func init() {
 			help:             "Retrieve eligible upgrades for the vehicle from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/dx/vehicles/upgrades/eligibility?vin={vin}",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -538,7 +618,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching eligible upgrades for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -546,6 +626,8 @@ func init() {
 			help:             "Retrieve the fleet telemetry configuration for the vehicle from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/vehicles/{vin}/fleet_telemetry_config",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -557,7 +639,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching fleet telemetry config for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -565,6 +647,8 @@ func init() {
 			help:             "Retrieve nearby charging sites for the vehicle from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/vehicles/{vin}/nearby_charging_sites",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -576,7 +660,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching nearby charging sites for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -584,6 +668,8 @@ func init() {
 			help:             "Retrieve vehicle options based on the VIN from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/dx/vehicles/options?vin={vin}",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -595,7 +681,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching vehicle options for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -603,6 +689,8 @@ func init() {
 			help:             "Retrieve recent alerts for the vehicle from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/vehicles/{vin}/recent_alerts",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -614,7 +702,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching recent alerts for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -622,6 +710,8 @@ func init() {
 			help:             "Retrieve release notes for the vehicle from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/vehicles/{vin}/release_notes",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -633,7 +723,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching release notes for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -641,6 +731,8 @@ func init() {
 			help:             "Retrieve service data for the vehicle from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/vehicles/{vin}/service_data",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -652,7 +744,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching service data for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -660,6 +752,8 @@ func init() {
 			help:             "Retrieve share invites for the vehicle from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/vehicles/{vin}/invitations",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -671,7 +765,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching share invites for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -679,6 +773,8 @@ func init() {
 			help:             "Retrieve basic details about the vehicle from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/vehicles/{vin}",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -690,7 +786,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching vehicle details for VIN %s: %w", vin, err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -698,6 +794,8 @@ func init() {
 			help:             "Fetch vehicle data from the Fleet API.",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/vehicles/{vin}/vehicle_data",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				vin := car.VIN()
 				if vin == "" {
@@ -709,7 +807,7 @@ func init() {
 				if err != nil {
 					return fmt.Errorf("error fetching vehicle data: %w", err)
 				}
-				fmt.Println(string(reply))
+				respondJSON(ctx, reply)
 				return nil
 			},
 		},
@@ -721,7 +819,7 @@ func init() {
 				Argument{name: "ENDPOINT", help: "Fleet API endpoint"},
 			},
 			optional: []Argument{
-				Argument{name: "FILE", help: "JSON file to POST"},
+				Argument{name: "FILE", help: "JSON file to POST", typ: argFile},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				var jsonBytes []byte
@@ -737,7 +835,7 @@ func init() {
 				reply, err := acct.Post(ctx, args["ENDPOINT"], jsonBytes)
 				// reply can be set where there's an error; typically a JSON blob providing details
 				if reply != nil {
-					fmt.Println(string(reply))
+					respondJSON(ctx, reply)
 				}
 				if err != nil {
 					return err
@@ -748,12 +846,22 @@ func init() {
 		"list-keys": &Command{
 			help:             "List public keys enrolled on vehicle",
 			requiresAuth:     false,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				summary, err := car.KeySummary(ctx)
 				if err != nil {
 					return err
 				}
+				type keyEntry struct {
+					Slot       uint32 `json:"slot"`
+					PublicKey  string `json:"public_key"`
+					Role       string `json:"role"`
+					FormFactor string `json:"form_factor"`
+				}
+				var entries []keyEntry
+				var lines []string
 				slot := uint32(0)
 				var details *vcsec.WhitelistEntryInfo
 				for mask := summary.GetSlotMask(); mask > 0; mask >>= 1 {
@@ -766,17 +874,26 @@ func init() {
 							}
 						}
 						if details != nil {
-							fmt.Printf("%02x\t%s\t%s\n", details.GetPublicKey().GetPublicKeyRaw(), details.GetKeyRole(), details.GetMetadataForKey().GetKeyFormFactor())
+							entry := keyEntry{
+								Slot:       slot,
+								PublicKey:  fmt.Sprintf("%02x", details.GetPublicKey().GetPublicKeyRaw()),
+								Role:       details.GetKeyRole().String(),
+								FormFactor: details.GetMetadataForKey().GetKeyFormFactor().String(),
+							}
+							entries = append(entries, entry)
+							lines = append(lines, fmt.Sprintf("%s\t%s\t%s", entry.PublicKey, entry.Role, entry.FormFactor))
 						}
 					}
 					slot++
 				}
+				respond(ctx, entries, strings.Join(lines, "\n"))
 				return nil
 			},
 		},
 		"honk": &Command{
 			help:             "Honk horn",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.HonkHorn(ctx)
@@ -786,6 +903,8 @@ func init() {
 			help:             "Ping vehicle",
 			requiresAuth:     true,
 			requiresFleetAPI: false,
+			idempotent:       true,
+			domain:           protocol.DomainInfotainment,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.Ping(ctx)
 			},
@@ -793,6 +912,7 @@ func init() {
 		"flash-lights": &Command{
 			help:         "Flash lights",
 			requiresAuth: true,
+			domain:       protocol.DomainInfotainment,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.FlashLights(ctx)
 			},
@@ -800,9 +920,11 @@ func init() {
 		"charging-set-limit": &Command{
 			help:             "Set charge limit to PERCENT",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "PERCENT", help: "Charging limit"},
+				Argument{name: "PERCENT", help: "Charging limit", typ: argPercent, min: 50, max: 100},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				limit, err := strconv.Atoi(args["PERCENT"])
@@ -815,9 +937,11 @@ func init() {
 		"charging-set-amps": &Command{
 			help:             "Set charge current to AMPS",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "AMPS", help: "Charging current"},
+				Argument{name: "AMPS", help: "Charging current", typ: argInt, min: 0, max: 80},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				limit, err := strconv.Atoi(args["AMPS"])
@@ -830,7 +954,9 @@ func init() {
 		"charging-start": &Command{
 			help:             "Start charging",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.ChargeStart(ctx)
 			},
@@ -838,7 +964,9 @@ func init() {
 		"charging-stop": &Command{
 			help:             "Stop charging",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.ChargeStop(ctx)
 			},
@@ -846,9 +974,11 @@ func init() {
 		"charging-schedule": &Command{
 			help:             "Schedule charging to MINS minutes after midnight and enable daily scheduling",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "MINS", help: "Time after midnight in minutes"},
+				Argument{name: "MINS", help: "Time after midnight in minutes", typ: argInt, min: 0, max: 24*60 - 1},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				minutesAfterMidnight, err := strconv.Atoi(args["MINS"])
@@ -863,7 +993,9 @@ func init() {
 		"charging-schedule-cancel": &Command{
 			help:             "Cancel scheduled charge start",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.ScheduleCharging(ctx, false, 0*time.Hour)
 			},
@@ -871,9 +1003,11 @@ func init() {
 		"media-set-volume": &Command{
 			help:             "Set volume",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "VOLUME", help: "Set volume (0.0-10.0"},
+				Argument{name: "VOLUME", help: "Set volume (0.0-10.0)", typ: argFloat, min: 0, max: 10},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				volume, err := strconv.ParseFloat(args["VOLUME"], 32)
@@ -886,6 +1020,7 @@ func init() {
 		"media-toggle-playback": &Command{
 			help:             "Toggle between play/pause",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
 			args:             []Argument{},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
@@ -895,11 +1030,14 @@ func init() {
 		"software-update-start": &Command{
 			help:             "Start software update after DELAY",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
 				Argument{
 					name: "DELAY",
 					help: "Time to wait before starting update. Examples: 2h, 10m.",
+					typ:  argDuration,
 				},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
@@ -914,7 +1052,9 @@ func init() {
 		"software-update-cancel": &Command{
 			help:             "Cancel a pending software update",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.CancelSoftwareUpdate(ctx)
 			},
@@ -922,9 +1062,11 @@ func init() {
 		"sentry-mode": &Command{
 			help:             "Set sentry mode to STATE ('on' or 'off')",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "STATE", help: "'on' or 'off'"},
+				Argument{name: "STATE", help: "'on' or 'off'", typ: argBool, enum: onOffValues},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				var state bool
@@ -943,6 +1085,7 @@ func init() {
 			help:             "Wake up vehicle",
 			requiresAuth:     false,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.Wakeup(ctx)
 			},
@@ -950,7 +1093,9 @@ func init() {
 		"tonneau-open": &Command{
 			help:             "Open Cybertruck tonneau.",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.OpenTonneau(ctx)
 			},
@@ -958,7 +1103,9 @@ func init() {
 		"tonneau-close": &Command{
 			help:             "Close Cybertruck tonneau.",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.CloseTonneau(ctx)
 			},
@@ -966,7 +1113,9 @@ func init() {
 		"tonneau-stop": &Command{
 			help:             "Stop moving Cybertruck tonneau.",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.StopTonneau(ctx)
 			},
@@ -974,7 +1123,10 @@ func init() {
 		"trunk-open": &Command{
 			help:             "Open vehicle trunk. Note that trunk-close only works on certain vehicle types.",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			// the vehicle handles this as a toggling move, so sending it twice can close the
+			// trunk again; it is not idempotent
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.OpenTrunk(ctx)
 			},
@@ -982,6 +1134,7 @@ func init() {
 		"trunk-move": &Command{
 			help:             "Toggle trunk open/closed. Closing is only available on certain vehicle types.",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.ActuateTrunk(ctx)
@@ -990,7 +1143,9 @@ func init() {
 		"trunk-close": &Command{
 			help:             "Closes vehicle trunk. Only available on certain vehicle types.",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.CloseTrunk(ctx)
 			},
@@ -998,7 +1153,10 @@ func init() {
 		"frunk-open": &Command{
 			help:             "Open vehicle frunk. Note that there's no frunk-close command!",
 			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
 			requiresFleetAPI: false,
+			// the vehicle handles this as a toggling move, so sending it twice can close the
+			// frunk again; it is not idempotent
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.OpenFrunk(ctx)
 			},
@@ -1006,7 +1164,9 @@ func init() {
 		"charge-port-open": &Command{
 			help:             "Open charge port",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.OpenChargePort(ctx)
 			},
@@ -1014,13 +1174,19 @@ func init() {
 		"charge-port-close": &Command{
 			help:             "Close charge port",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.CloseChargePort(ctx)
 			},
 		},
 		"autosecure-modelx": &Command{
-			help: "Close falcon-wing doors and lock vehicle. Model X only.",
+			help:             "Close falcon-wing doors and lock vehicle. Model X only.",
+			requiresAuth:     true,
+			domain:           protocol.DomainVCSEC,
+			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.AutoSecureVehicle(ctx)
 			},
@@ -1029,9 +1195,10 @@ func init() {
 			help:             "Retrieve session info for PUBLIC_KEY from DOMAIN",
 			requiresAuth:     false,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)"},
-				Argument{name: "DOMAIN", help: "'vcsec' or 'infotainment'"},
+				Argument{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)", typ: argFile},
+				Argument{name: "DOMAIN", help: "'vcsec' or 'infotainment'", typ: argEnum, enum: []string{"vcsec", "infotainment"}},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				// See SeatPosition definition for controlling backrest heaters (limited models).
@@ -1051,30 +1218,22 @@ func init() {
 				if err != nil {
 					return err
 				}
-				fmt.Printf("%s\n", info)
+				respondProto(ctx, info, fmt.Sprintf("%s", info))
 				return nil
 			},
 		},
 		"seat-heater": &Command{
 			help:             "Set seat heater at POSITION to LEVEL",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "SEAT", help: "<front|2nd-row|3rd-row>-<left|center|right> (e.g., 2nd-row-left)"},
-				Argument{name: "LEVEL", help: "off, low, medium, or high"},
+				Argument{name: "SEAT", help: "<front|2nd-row|3rd-row>-<left|center|right> (e.g., 2nd-row-left)", typ: argEnum, enum: sortedNames(seatPositions)},
+				Argument{name: "LEVEL", help: "off, low, medium, or high", typ: argEnum, enum: []string{"off", "low", "medium", "high"}},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-				// See SeatPosition definition for controlling backrest heaters (limited models).
-				seats := map[string]vehicle.SeatPosition{
-					"front-left":     vehicle.SeatFrontLeft,
-					"front-right":    vehicle.SeatFrontRight,
-					"2nd-row-left":   vehicle.SeatSecondRowLeft,
-					"2nd-row-center": vehicle.SeatSecondRowCenter,
-					"2nd-row-right":  vehicle.SeatSecondRowRight,
-					"3rd-row-left":   vehicle.SeatThirdRowLeft,
-					"3rd-row-right":  vehicle.SeatThirdRowRight,
-				}
-				position, ok := seats[args["SEAT"]]
+				position, ok := seatPositions[args["SEAT"]]
 				if !ok {
 					return fmt.Errorf("invalid seat position")
 				}
@@ -1097,9 +1256,11 @@ func init() {
 		"steering-wheel-heater": &Command{
 			help:             "Set steering wheel mode to STATE ('on' or 'off')",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "STATE", help: "'on' or 'off'"},
+				Argument{name: "STATE", help: "'on' or 'off'", typ: argBool, enum: onOffValues},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				var state bool
@@ -1118,24 +1279,28 @@ func init() {
 			help:             "Print JSON product info",
 			requiresAuth:     false,
 			requiresFleetAPI: true,
+			idempotent:       true,
+			endpoint:         "api/1/products",
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				productsJSON, err := acct.Get(ctx, "api/1/products")
 				if err != nil {
 					return err
 				}
-				fmt.Println(string(productsJSON))
+				respondJSON(ctx, productsJSON)
 				return nil
 			},
 		},
 		"auto-seat-and-climate": &Command{
 			help:             "Turn on automatic seat heating and HVAC",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			args: []Argument{
-				Argument{name: "POSITIONS", help: "'L' (left), 'R' (right), or 'LR'"},
+				Argument{name: "POSITIONS", help: "'L' (left), 'R' (right), or 'LR'", typ: argEnum, enum: []string{"L", "R", "LR"}},
 			},
 			optional: []Argument{
-				Argument{name: "STATE", help: "'on' (default) or 'off'"},
+				Argument{name: "STATE", help: "'on' (default) or 'off'", typ: argBool, enum: onOffValues},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				var positions []vehicle.SeatPosition
@@ -1158,7 +1323,9 @@ func init() {
 		"windows-vent": &Command{
 			help:             "Vent all windows",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.VentWindows(ctx)
 			},
@@ -1166,7 +1333,9 @@ func init() {
 		"windows-close": &Command{
 			help:             "Close all windows",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.CloseWindows(ctx)
 			},
@@ -1176,6 +1345,7 @@ func init() {
 			domain:           protocol.DomainVCSEC,
 			requiresAuth:     false,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				info, err := car.BodyControllerState(ctx)
 				if err != nil {
@@ -1187,14 +1357,16 @@ func init() {
 					EmitUnpopulated:   false,
 					EmitDefaultValues: true,
 				}
-				fmt.Println(options.Format(info))
+				respondProto(ctx, info, options.Format(info))
 				return nil
 			},
 		},
 		"guest-mode-on": &Command{
 			help:             "Enable Guest Mode. See https://developer.tesla.com/docs/fleet-api/endpoints/vehicle-commands#guest-mode.",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.SetGuestMode(ctx, true)
 			},
@@ -1202,7 +1374,9 @@ func init() {
 		"guest-mode-off": &Command{
 			help:             "Disable Guest Mode.",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.SetGuestMode(ctx, false)
 			},
@@ -1210,7 +1384,9 @@ func init() {
 		"erase-guest-data": &Command{
 			help:             "Erase Guest Mode user data",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
+			idempotent:       true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				return car.EraseGuestData(ctx)
 			},
@@ -1218,17 +1394,18 @@ func init() {
 		"charging-schedule-add": &Command{
 			help:             "Schedule charge for DAYS START_TIME-END_TIME at LATITUDE LONGITUDE. The END_TIME may be on the following day.",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
 			args: []Argument{
-				Argument{name: "DAYS", help: "Comma-separated list of any of Sun, Mon, Tues, Wed, Thurs, Fri, Sat OR all OR weekdays"},
-				Argument{name: "TIME", help: "Time interval to charge (24-hour clock). Examples: '22:00-6:00', '-6:00', '20:32-"},
-				Argument{name: "LATITUDE", help: "Latitude of charging site"},
-				Argument{name: "LONGITUDE", help: "Longitude of charging site"},
+				Argument{name: "DAYS", help: "Comma-separated list of any of Sun, Mon, Tues, Wed, Thurs, Fri, Sat OR all OR weekdays", typ: argDays, enum: dayNames()},
+				Argument{name: "TIME", help: "Time interval to charge (24-hour clock). Examples: '22:00-6:00', '-6:00', '20:32-", typ: argTimeRange},
+				Argument{name: "LATITUDE", help: "Latitude of charging site", typ: argLatitude},
+				Argument{name: "LONGITUDE", help: "Longitude of charging site", typ: argLongitude},
 			},
 			optional: []Argument{
-				Argument{name: "REPEAT", help: "Set to 'once' or omit to repeat weekly"},
-				Argument{name: "ID", help: "The ID of the charge schedule to modify. Not required for new schedules."},
-				Argument{name: "ENABLED", help: "Whether the charge schedule is enabled. Expects 'true' or 'false'. Defaults to true."},
+				Argument{name: "REPEAT", help: "Set to 'once' or omit to repeat weekly", typ: argEnum, enum: []string{"once"}},
+				Argument{name: "ID", help: "The ID of the charge schedule to modify. Not required for new schedules.", typ: argInt},
+				Argument{name: "ENABLED", help: "Whether the charge schedule is enabled. Expects 'true' or 'false'. Defaults to true.", typ: argBool, enum: []string{"true", "false"}},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				var err error
@@ -1284,7 +1461,7 @@ func init() {
 				if err := car.AddChargeSchedule(ctx, &schedule); err != nil {
 					return err
 				}
-				fmt.Printf("%d\n", schedule.Id)
+				respond(ctx, map[string]uint64{"id": schedule.Id}, fmt.Sprintf("%d", schedule.Id))
 				return nil
 			},
 		},
@@ -1292,11 +1469,13 @@ func init() {
 			help:             "Removes charging schedule of TYPE [ID]",
 			requiresAuth:     true,
 			requiresFleetAPI: false,
+			idempotent:       true,
+			domain:           protocol.DomainInfotainment,
 			args: []Argument{
-				Argument{name: "TYPE", help: "home|work|other|id"},
+				Argument{name: "TYPE", help: "home|work|other|id", typ: argEnum, enum: []string{"home", "work", "other", "id"}},
 			},
 			optional: []Argument{
-				Argument{name: "ID", help: "numeric ID of schedule to remove when TYPE set to id"},
+				Argument{name: "ID", help: "numeric ID of schedule to remove when TYPE set to id", typ: argInt},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				var home, work, other bool
@@ -1326,17 +1505,18 @@ func init() {
 		"precondition-schedule-add": &Command{
 			help:             "Schedule precondition for DAYS TIME at LATITUDE LONGITUDE.",
 			requiresAuth:     true,
+			domain:           protocol.DomainInfotainment,
 			requiresFleetAPI: false,
 			args: []Argument{
-				Argument{name: "DAYS", help: "Comma-separated list of any of Sun, Mon, Tues, Wed, Thurs, Fri, Sat OR all OR weekdays"},
-				Argument{name: "TIME", help: "Time to precondition by. Example: '22:00'"},
-				Argument{name: "LATITUDE", help: "Latitude of location to precondition at."},
-				Argument{name: "LONGITUDE", help: "Longitude of location to precondition at."},
+				Argument{name: "DAYS", help: "Comma-separated list of any of Sun, Mon, Tues, Wed, Thurs, Fri, Sat OR all OR weekdays", typ: argDays, enum: dayNames()},
+				Argument{name: "TIME", help: "Time to precondition by. Example: '22:00'", typ: argTime},
+				Argument{name: "LATITUDE", help: "Latitude of location to precondition at.", typ: argLatitude},
+				Argument{name: "LONGITUDE", help: "Longitude of location to precondition at.", typ: argLongitude},
 			},
 			optional: []Argument{
-				Argument{name: "REPEAT", help: "Set to 'once' or omit to repeat weekly"},
-				Argument{name: "ID", help: "The ID of the precondition schedule to modify. Not required for new schedules."},
-				Argument{name: "ENABLED", help: "Whether the precondition schedule is enabled. Expects 'true' or 'false'. Defaults to true."},
+				Argument{name: "REPEAT", help: "Set to 'once' or omit to repeat weekly", typ: argEnum, enum: []string{"once"}},
+				Argument{name: "ID", help: "The ID of the precondition schedule to modify. Not required for new schedules.", typ: argInt},
+				Argument{name: "ENABLED", help: "Whether the precondition schedule is enabled. Expects 'true' or 'false'. Defaults to true.", typ: argBool, enum: []string{"true", "false"}},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				var err error
@@ -1385,7 +1565,7 @@ func init() {
 				if err := car.AddPreconditionSchedule(ctx, &schedule); err != nil {
 					return err
 				}
-				fmt.Printf("%d\n", schedule.Id)
+				respond(ctx, map[string]uint64{"id": schedule.Id}, fmt.Sprintf("%d", schedule.Id))
 				return nil
 			},
 		},
@@ -1393,11 +1573,13 @@ func init() {
 			help:             "Removes precondition schedule of TYPE [ID]",
 			requiresAuth:     true,
 			requiresFleetAPI: false,
+			idempotent:       true,
+			domain:           protocol.DomainInfotainment,
 			args: []Argument{
-				Argument{name: "TYPE", help: "home|work|other|id"},
+				Argument{name: "TYPE", help: "home|work|other|id", typ: argEnum, enum: []string{"home", "work", "other", "id"}},
 			},
 			optional: []Argument{
-				Argument{name: "ID", help: "numeric ID of schedule to remove when TYPE set to id"},
+				Argument{name: "ID", help: "numeric ID of schedule to remove when TYPE set to id", typ: argInt},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				var home, work, other bool
@@ -1428,8 +1610,10 @@ func init() {
 			help:             "Fetch vehicle state over BLE.",
 			requiresAuth:     true,
 			requiresFleetAPI: false,
+			idempotent:       true,
+			domain:           protocol.DomainInfotainment,
 			args: []Argument{
-				Argument{name: "CATEGORY", help: "One of " + strings.Join(categoryNames(), ", ")},
+				Argument{name: "CATEGORY", help: "One of " + strings.Join(categoryNames(), ", "), typ: argEnum, enum: categoryNames()},
 			},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
 				category, err := GetCategory(args["CATEGORY"])
@@ -1440,14 +1624,58 @@ func init() {
 				if err != nil {
 					return err
 				}
-				fmt.Println(protojson.Format(data))
+				respondProto(ctx, data, renderState(args["CATEGORY"], data))
 				return nil
 			},
 		},
+		"commands": &Command{
+			help:             "List commands with their arguments. Use --json for the machine-readable catalogue.",
+			requiresAuth:     false,
+			requiresFleetAPI: false,
+			local:            true,
+			optional: []Argument{
+				Argument{name: "FORMAT", help: "--json to export the catalogue as JSON", typ: argEnum, enum: []string{"--json"}},
+			},
+			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+				return listCommands(ctx, args["FORMAT"])
+			},
+		},
+		"completion": &Command{
+			help:             "Print a completion script for SHELL, e.g. source <(tesla-control completion bash)",
+			requiresAuth:     false,
+			requiresFleetAPI: false,
+			local:            true,
+			args: []Argument{
+				Argument{name: "SHELL", help: "One of: bash, zsh, fish", typ: argEnum, enum: []string{"bash", "zsh", "fish"}},
+			},
+			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+				script, err := completionScript(args["SHELL"])
+				if err != nil {
+					return err
+				}
+				respond(ctx, script, strings.TrimRight(script, "\n"))
+				return nil
+			},
+		},
+		"vehicles": &Command{
+			help:             "List vehicles on the account, or select the default vehicle and manage aliases",
+			requiresAuth:     false,
+			requiresFleetAPI: true,
+			idempotent:       true,
+			optional: []Argument{
+				Argument{name: "ACTION", help: "One of: list, use, alias, unalias", typ: argEnum, enum: []string{vehiclesList, vehiclesUse, vehiclesAlias, vehiclesUnalias}},
+				Argument{name: "NAME", help: "Alias, VIN or display name (use), or the alias to define (alias, unalias)"},
+				Argument{name: "VIN", help: "VIN, alias or display name the alias refers to (alias)"},
+			},
+			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+				return manageVehicles(ctx, acct, args)
+			},
+		},
 		"help": &Command{
 			help:             "Show this help message or help for specific commands",
 			requiresAuth:     false,
 			requiresFleetAPI: false,
+			local:            true,
 			args:             []Argument{{name: "COMMAND", help: "Optional: get help for a specific command"}},
 			optional:         []Argument{},
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
@@ -1463,22 +1691,15 @@ func init() {
 			help:             "Exit the program",
 			requiresAuth:     false,
 			requiresFleetAPI: false,
+			local:            true,
 			handler: func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-				os.Exit(0)
-				return nil // technically unreachable, but good practice to include it
+				// The shell, scripts and rpc mode stop when they read exit, then disconnect as
+				// usual. On its own, the command has nothing to do.
+				return nil
 			},
 		},
 	}
-}
 
-func customCompleter(line string) []string {
-	var suggestions []string
-	for cmdName := range commands {
-		if strings.HasPrefix(cmdName, line) {
-			suggestions = append(suggestions, cmdName)
-		}
-	}
-	return suggestions
 }
 
 func ContextSensitiveHelp(input string) {
@@ -1512,10 +1733,14 @@ func ContextSensitiveHelp(input string) {
 	fmt.Println("No matching command found. Use tab for auto-completion.")
 }
 
-func InteractiveCommandBuilding(acct *account.Account, car *vehicle.Vehicle) {
+// InteractiveCommandBuilding runs the interactive shell until exit, end of input or the
+// cancellation of ctx. Ctrl-C at the prompt discards the line; while a command runs, it cancels
+// that command and returns to the prompt. Each command gets timeout.
+func InteractiveCommandBuilding(ctx context.Context, s *session, timeout time.Duration) {
+	const prompt = "tesla> "
 	l, err := readline.NewEx(&readline.Config{
-		Prompt:          "tesla> ",
-		AutoComplete:    readline.NewPrefixCompleter(readline.PcItemDynamic(customCompleter)),
+		Prompt:          prompt,
+		AutoComplete:    shellCompleter{},
 		InterruptPrompt: "^C",
 	})
 	if err != nil {
@@ -1523,9 +1748,16 @@ func InteractiveCommandBuilding(acct *account.Account, car *vehicle.Vehicle) {
 	}
 	defer l.Close()
 
+	// closing readline ends a Readline call waiting at the prompt
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
 	for {
 		line, err := l.Readline()
-		if err != nil { // io.EOF
+		if err == readline.ErrInterrupt {
+			continue
+		}
+		if err != nil || ctx.Err() != nil { // io.EOF
 			break
 		}
 
@@ -1536,7 +1768,7 @@ func InteractiveCommandBuilding(acct *account.Account, car *vehicle.Vehicle) {
 
 			// check for exit command
 			if cmdName == "exit" {
-				os.Exit(0)
+				return
 			}
 
 			// check for help command
@@ -1558,18 +1790,27 @@ func InteractiveCommandBuilding(acct *account.Account, car *vehicle.Vehicle) {
 
 			// gather all arguments except the command name
 			commandArgs := args[1:]
+			abandoned := false
 			if len(commandArgs) < len(cmd.args) {
-				// prompt for missing arguments
-				for i := len(commandArgs); i < len(cmd.args); i++ {
+				// prompt for missing arguments, Ctrl-C abandons the command
+				for i := len(commandArgs); i < len(cmd.args) && !abandoned; i++ {
 					l.SetPrompt(fmt.Sprintf("%s %s> ", cmdName, strings.Join(commandArgs, " ")))
-					nextArg, _ := l.Readline()
+					nextArg, err := l.Readline()
+					abandoned = err != nil
 					commandArgs = append(commandArgs, nextArg)
 				}
+				l.SetPrompt(prompt)
+			}
+			if abandoned {
+				continue
 			}
 
-			ctx := context.Background()
-			if err := execute(ctx, acct, car, append([]string{cmdName}, commandArgs...)); err != nil {
-				fmt.Println("Error executing command:", err)
+			// Ctrl-C cancels only this command
+			cmdCtx, release := signalContext(ctx, os.Interrupt)
+			r := invoke(cmdCtx, s, append([]string{cmdName}, commandArgs...), timeout)
+			release()
+			if r.err != nil && outputMode == outputText {
+				fmt.Printf("Error executing command (%s): %s\n", r.ErrorClass, r.err)
 			}
 		} else {
 			// if the line is empty, it might be nice to show all commands or a general help message
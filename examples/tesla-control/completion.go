@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/inindev/tesla_utils/auth"
+)
+
+// completeCommand is the hidden command that completion scripts call back into. Its arguments are
+// the words typed so far followed by the (possibly empty) word being completed.
+const completeCommand = "__complete"
+
+// Values offered for flags that take one.
+var flagValues = map[string]func() []string{
+	"output": func() []string { return []string{outputText, outputJSON} },
+	"units":  func() []string { return []string{auth.UnitsMetric, auth.UnitsImperial} },
+	"vin":    vehicleNames,
+}
+
+const bashCompletion = `# bash completion for %[1]s
+_%[2]s() {
+    local IFS=$'\n'
+    COMPREPLY=($("${COMP_WORDS[0]}" %[3]s "${COMP_WORDS[@]:1:COMP_CWORD-1}" "${COMP_WORDS[COMP_CWORD]}" 2>/dev/null))
+}
+complete -F _%[2]s %[1]s
+`
+
+const zshCompletion = `#compdef %[1]s
+_%[2]s() {
+    local -a candidates
+    candidates=("${(@f)$("${words[1]}" %[3]s "${(@)words[2,CURRENT-1]}" "${words[CURRENT]}" 2>/dev/null)}")
+    compadd -Q -- "${(@)candidates:#}"
+}
+if [ "$funcstack[1]" = "_%[2]s" ]; then
+    _%[2]s "$@"
+else
+    compdef _%[2]s %[1]s
+fi
+`
+
+const fishCompletion = `# fish completion for %[1]s
+function __%[2]s_complete
+    set -l tokens (commandline -opc)
+    $tokens[1] %[3]s $tokens[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c %[1]s -f -a '(__%[2]s_complete)'
+`
+
+// completionScript returns the completion script for shell.
+func completionScript(shell string) (string, error) {
+	name := filepath.Base(os.Args[0])
+	fn := strings.NewReplacer("-", "_", ".", "_").Replace(name)
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return "", fmt.Errorf("%w: unsupported SHELL '%s'", ErrCommandLineArgs, shell)
+	}
+	return fmt.Sprintf(script, name, fn, completeCommand), nil
+}
+
+// takesValue reports whether the global flag name consumes the following word.
+func takesValue(name string) bool {
+	f := flag.Lookup(name)
+	if f == nil {
+		_, ok := flagValues[name]
+		return ok
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return false
+	}
+	return true
+}
+
+// completeWords returns the candidates for current, given the words before it. Global flags may
+// precede the command name.
+func completeWords(words []string, current string) []string {
+	var (
+		command string
+		args    []string
+		pending string // flag waiting for its value
+	)
+	for _, word := range words {
+		switch {
+		case pending != "":
+			pending = ""
+		case command == "" && strings.HasPrefix(word, "-"):
+			name := strings.TrimLeft(word, "-")
+			if !strings.Contains(name, "=") && takesValue(name) {
+				pending = name
+			}
+		case command == "":
+			command = word
+		default:
+			args = append(args, word)
+		}
+	}
+
+	var candidates []string
+	switch {
+	case pending != "":
+		if values, ok := flagValues[pending]; ok {
+			candidates = values()
+		}
+	case command == "" && strings.HasPrefix(current, "-"):
+		flag.VisitAll(func(f *flag.Flag) {
+			candidates = append(candidates, "-"+f.Name)
+		})
+	case command == "":
+		candidates = commandNames()
+	case command == "help":
+		if len(args) == 0 {
+			candidates = commandNames()
+		}
+	default:
+		info, ok := commands[command]
+		if !ok {
+			return nil
+		}
+		all := append(append([]Argument{}, info.args...), info.optional...)
+		if len(args) < len(all) {
+			return completeArgument(all[len(args)], current)
+		}
+	}
+	return filterPrefix(candidates, current)
+}
+
+// completeArgument offers values for a single argument.
+func completeArgument(arg Argument, current string) []string {
+	switch arg.typ {
+	case argFile:
+		return completeFiles(current)
+	case argDays:
+		// complete the last item of the comma-separated list
+		head := ""
+		if i := strings.LastIndex(current, ","); i >= 0 {
+			head, current = current[:i+1], current[i+1:]
+		}
+		var candidates []string
+		for _, day := range filterPrefix(arg.enum, strings.ToLower(current)) {
+			candidates = append(candidates, head+day)
+		}
+		return candidates
+	}
+	return filterPrefix(arg.enum, current)
+}
+
+func completeFiles(current string) []string {
+	matches, _ := filepath.Glob(current + "*")
+	for i, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			matches[i] = match + string(filepath.Separator)
+		}
+	}
+	return matches
+}
+
+// commandNames lists the commands offered for completion, including the rpc mode.
+func commandNames() []string {
+	return append(sortedNames(commands), rpcCommand)
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// accountVINs returns the VINs saved by the last "vehicles list".
+var accountVINs = auth.LoadAccountVins
+
+// vehicleNames offers the values -vin accepts: "all", the configured aliases and groups, the
+// default VIN and the VINs seen by the last "vehicles list". Completion must be fast and must never
+// prompt, so the account's vehicle list is read from that cache rather than fetched.
+func vehicleNames() []string {
+	names := []string{vinAll}
+	if aliases, err := auth.GetAliases(); err == nil {
+		names = append(names, sortedNames(aliases)...)
+	}
+	if groups, err := auth.GetGroups(); err == nil {
+		names = append(names, sortedNames(groups)...)
+	}
+	vins := map[string]bool{}
+	if vin, err := auth.GetVin(); err == nil {
+		vins[strings.ToUpper(vin)] = true
+	}
+	if cached, err := accountVINs(); err == nil {
+		for _, vin := range cached {
+			vins[vin] = true
+		}
+	}
+	return append(names, sortedNames(vins)...)
+}
+
+// shellCompleter completes command lines in the interactive shell.
+type shellCompleter struct{}
+
+func (shellCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+	words := strings.Fields(text)
+	current := ""
+	if len(words) > 0 && !strings.HasSuffix(text, " ") {
+		current = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	var suffixes [][]rune
+	for _, c := range completeWords(words, current) {
+		suffixes = append(suffixes, []rune(c[len(current):]+" "))
+	}
+	return suffixes, len([]rune(current))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompleteWords(t *testing.T) {
+	testCases := []struct {
+		words      []string
+		current    string
+		candidates []string
+	}{
+		{words: nil, current: "charging-sta", candidates: []string{"charging-start"}},
+		{words: []string{"-output", "json"}, current: "hon", candidates: []string{"honk"}},
+		{words: []string{"-output"}, current: "", candidates: []string{"json", "text"}},
+		{words: []string{"state"}, current: "ti", candidates: []string{"tire-pressure"}},
+		{words: []string{"seat-heater", "front-left"}, current: "m", candidates: []string{"medium"}},
+		{words: []string{"charging-schedule-add"}, current: "sat,su", candidates: []string{"sat,sun", "sat,sunday"}},
+		{words: []string{"help"}, current: "wak", candidates: []string{"wake"}},
+		{words: []string{"honk"}, current: "", candidates: nil},
+		{words: []string{"no-such-command"}, current: "", candidates: nil},
+	}
+	for _, test := range testCases {
+		candidates := completeWords(test.words, test.current)
+		if !reflect.DeepEqual(candidates, test.candidates) {
+			t.Errorf("completeWords(%q, %q) = %q, expected %q", test.words, test.current, candidates, test.candidates)
+		}
+	}
+}
+
+func TestCompleteVehicleNames(t *testing.T) {
+	t.Setenv("TESLA_ALIASES", "blue-y=7SA00000000000000;red-3=5YJ3E1EA7KF123456")
+	t.Setenv("TESLA_GROUPS", "family=blue-y,red-3")
+	t.Setenv("TESLA_VIN", "5YJ3E1EA7KF123456")
+	defer func(saved func() ([]string, error)) { accountVINs = saved }(accountVINs)
+	accountVINs = func() ([]string, error) { return nil, nil }
+
+	candidates := completeWords([]string{"-vin"}, "")
+	expected := []string{"5YJ3E1EA7KF123456", "all", "blue-y", "family", "red-3"}
+	if !reflect.DeepEqual(candidates, expected) {
+		t.Errorf("got %q, expected %q", candidates, expected)
+	}
+
+	// vehicles seen by the last listing are offered once, alongside the default
+	accountVINs = func() ([]string, error) {
+		return []string{"5YJ3E1EA7KF123456", "7SAYGDEE1PF000001"}, nil
+	}
+	candidates = completeWords([]string{"-vin"}, "7")
+	expected = []string{"7SAYGDEE1PF000001"}
+	if !reflect.DeepEqual(candidates, expected) {
+		t.Errorf("got %q, expected %q", candidates, expected)
+	}
+	candidates = completeWords([]string{"-vin"}, "5")
+	expected = []string{"5YJ3E1EA7KF123456"}
+	if !reflect.DeepEqual(candidates, expected) {
+		t.Errorf("got %q, expected %q", candidates, expected)
+	}
+}
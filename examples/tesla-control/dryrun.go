@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inindev/tesla_utils/auth"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Returned by the dry-run connector and HTTP transport in place of sending anything.
+var errDryRun = errors.New("dry run: request not sent")
+
+// dryRunVIN stands in for the vehicle when no VIN is configured.
+const dryRunVIN = "5YJ3E1EA0KF000000"
+
+// plannedRequest describes a single message that a command would send.
+type plannedRequest struct {
+	Method   string          `json:"method"`
+	Endpoint string          `json:"endpoint"`
+	Domain   string          `json:"domain,omitempty"`
+	Action   string          `json:"action,omitempty"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+}
+
+// dryRunPlan is the response of a command run with -dry-run.
+type dryRunPlan struct {
+	Transport    string           `json:"transport"`
+	RequiresAuth bool             `json:"requires_auth"`
+	WakeRequired bool             `json:"wake_required"`
+	Requests     []plannedRequest `json:"requests"`
+}
+
+// dryRunConnector records the messages a vehicle.Vehicle sends and fails each send. Commands are
+// left unauthenticated so that no session or private key is needed to build them.
+type dryRunConnector struct {
+	vin  string
+	host string
+	recv chan []byte
+
+	lock     sync.Mutex
+	messages []*universal.RoutableMessage
+	requests []plannedRequest // REST calls made through the connector, such as wake_up
+}
+
+func newDryRunConnector(vin, host string) *dryRunConnector {
+	return &dryRunConnector{vin: vin, host: host, recv: make(chan []byte)}
+}
+
+func (c *dryRunConnector) Receive() <-chan []byte { return c.recv }
+
+func (c *dryRunConnector) Send(ctx context.Context, buffer []byte) error {
+	var message universal.RoutableMessage
+	if err := proto.Unmarshal(buffer, &message); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.messages = append(c.messages, &message)
+	c.lock.Unlock()
+	return errDryRun
+}
+
+func (c *dryRunConnector) VIN() string { return c.vin }
+
+func (c *dryRunConnector) Close() {}
+
+func (c *dryRunConnector) PreferredAuthMethod() connector.AuthMethod {
+	return connector.AuthMethodNone
+}
+
+func (c *dryRunConnector) RetryInterval() time.Duration { return time.Second }
+
+func (c *dryRunConnector) AllowedLatency() time.Duration { return time.Second }
+
+// Wakeup and SendFleetAPICommand make dryRunConnector a connector.FleetAPIConnector, like the
+// Fleet API connection it stands in for.
+func (c *dryRunConnector) Wakeup(ctx context.Context) error {
+	_, err := c.SendFleetAPICommand(ctx, fmt.Sprintf("api/1/vehicles/%s/wake_up", c.vin), nil)
+	return err
+}
+
+func (c *dryRunConnector) SendFleetAPICommand(ctx context.Context, endpoint string, command interface{}) ([]byte, error) {
+	planned := plannedRequest{Method: http.MethodPost, Endpoint: fmt.Sprintf("https://%s/%s", c.host, endpoint)}
+	if command != nil {
+		planned.Payload, _ = json.Marshal(command)
+	}
+	c.lock.Lock()
+	c.requests = append(c.requests, planned)
+	c.lock.Unlock()
+	return nil, errDryRun
+}
+
+// dryRunTransport records Fleet API requests and fails each one.
+type dryRunTransport struct {
+	lock     sync.Mutex
+	requests []plannedRequest
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	planned := plannedRequest{Method: req.Method, Endpoint: req.URL.String()}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if json.Valid(body) {
+			planned.Payload = body
+		} else if len(body) > 0 {
+			planned.Payload, _ = json.Marshal(string(body))
+		}
+	}
+	t.lock.Lock()
+	t.requests = append(t.requests, planned)
+	t.lock.Unlock()
+	return nil, errDryRun
+}
+
+// dryRunAccount returns an account for the configured Fleet API host. The token is a placeholder;
+// it is never sent.
+func dryRunAccount() (*account.Account, error) {
+	claims, err := json.Marshal(map[string]interface{}{"aud": []string{auth.Audience}, "sub": "dry-run"})
+	if err != nil {
+		return nil, err
+	}
+	token := "e30." + base64.RawStdEncoding.EncodeToString(claims) + ".e30"
+	return account.New(token, "")
+}
+
+// actionName returns the path of singly-set message fields in msg, which names the action a
+// payload carries, e.g. vehicleAction.chargingSetLimitAction. Top-level scalars such as VCSEC's
+// RKEAction name themselves.
+func actionName(msg protoreflect.Message) string {
+	var path []string
+	for {
+		var fields []protoreflect.FieldDescriptor
+		msg.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			fields = append(fields, fd)
+			return true
+		})
+		if len(fields) != 1 {
+			break
+		}
+		name := string(fields[0].Name())
+		if fields[0].Kind() != protoreflect.MessageKind || fields[0].IsList() || fields[0].IsMap() {
+			if len(path) == 0 {
+				path = append(path, name)
+			}
+			break
+		}
+		path = append(path, name)
+		msg = msg.Get(fields[0]).Message()
+	}
+	return strings.Join(path, ".")
+}
+
+// describeMessage decodes the payload of a routable message for the plan.
+func describeMessage(endpoint string, message *universal.RoutableMessage) plannedRequest {
+	planned := plannedRequest{Method: http.MethodPost, Endpoint: endpoint}
+	var payload proto.Message
+	switch domain := message.GetToDestination().GetDomain(); domain {
+	case universal.Domain_DOMAIN_INFOTAINMENT:
+		planned.Domain = "infotainment"
+		payload = &carserver.Action{}
+	case universal.Domain_DOMAIN_VEHICLE_SECURITY:
+		planned.Domain = "vcsec"
+		payload = &vcsec.UnsignedMessage{}
+	default:
+		planned.Domain = domain.String()
+	}
+	if payload != nil {
+		if err := proto.Unmarshal(message.GetProtobufMessageAsBytes(), payload); err == nil {
+			planned.Action = actionName(payload.ProtoReflect())
+			options := protojson.MarshalOptions{UseProtoNames: true}
+			planned.Payload, _ = options.Marshal(payload)
+		}
+	}
+	return planned
+}
+
+// haveCredentials reports which credentials are available without using the network.
+func haveCredentials() (privateKey, oauth bool) {
+	if keyFile, err := auth.GetKeyFile(); err == nil {
+		_, statErr := os.Stat(keyFile)
+		privateKey = statErr == nil
+	}
+	_, err := auth.LoadAuthData()
+	return privateKey, err == nil
+}
+
+// dryRun builds the messages that args would send and responds with a description of them,
+// without using the network.
+func dryRun(ctx context.Context, args []string) error {
+	info, ok := commands[args[0]]
+	if !ok {
+		return ErrUnknownCommand
+	}
+	keywords, err := info.parseArgs(args[1:])
+	if err != nil {
+		return err
+	}
+
+	plan := dryRunPlan{
+		Transport:    info.transport(),
+		RequiresAuth: info.requiresAuth,
+		WakeRequired: !info.local && !info.requiresFleetAPI && args[0] != "wake",
+		Requests:     []plannedRequest{},
+	}
+	if !info.local {
+		vin, _ := configuredVIN()
+		if r := resultFromContext(ctx); r != nil && r.VIN != "" {
+			vin = r.VIN // one of several vehicles selected with -vin
+		}
+		havePrivateKey, haveOAuth := haveCredentials()
+		if _, err := checkReadiness(args[0], havePrivateKey, haveOAuth, vin != ""); err != nil {
+			return err
+		}
+		if vin == "" {
+			vin = dryRunVIN
+		}
+
+		acct, err := dryRunAccount()
+		if err != nil {
+			return err
+		}
+		transport := &dryRunTransport{}
+		defaultTransport := http.DefaultTransport
+		http.DefaultTransport = transport
+		defer func() { http.DefaultTransport = defaultTransport }()
+
+		conn := newDryRunConnector(vin, acct.Host)
+		car, err := vehicle.NewVehicle(conn, nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := car.Connect(ctx); err != nil {
+			return err
+		}
+		defer car.Disconnect()
+
+		// The handler's own output is discarded; only the captured requests matter.
+		err = info.handler(withResult(ctx, newResult(args[0])), acct, car, keywords)
+		if err != nil && !errors.Is(err, errDryRun) && len(conn.messages) == 0 && len(conn.requests) == 0 && len(transport.requests) == 0 {
+			return err
+		}
+
+		plan.Requests = append(plan.Requests, transport.requests...)
+		plan.Requests = append(plan.Requests, conn.requests...)
+		signedEndpoint := fmt.Sprintf("https://%s/api/1/vehicles/%s/signed_command", acct.Host, vin)
+		for _, message := range conn.messages {
+			plan.Requests = append(plan.Requests, describeMessage(signedEndpoint, message))
+		}
+	}
+
+	respond(ctx, plan, plan.text(args[0], keywords))
+	return nil
+}
+
+func (p *dryRunPlan) text(command string, keywords map[string]string) string {
+	r := &report{}
+	names := sortedNames(keywords)
+	for i, name := range names {
+		names[i] = name + "=" + keywords[name]
+	}
+	r.add("Command", "%s", strings.TrimSpace(command+" "+strings.Join(names, " ")))
+	switch p.Transport {
+	case "local":
+		r.add("Transport", "local, nothing is sent")
+	case "fleet-api":
+		r.add("Transport", "Fleet API REST")
+	default:
+		r.add("Transport", "signed protocol via Fleet API")
+	}
+	r.add("Wake required", "%t", p.WakeRequired)
+	for i, req := range p.Requests {
+		prefix := fmt.Sprintf("Request %d", i+1)
+		r.add(prefix, "%s %s", req.Method, req.Endpoint)
+		if req.Domain != "" {
+			r.add("  Domain", "%s", req.Domain)
+		}
+		if req.Action != "" {
+			r.add("  Action", "%s", req.Action)
+		}
+		if len(req.Payload) > 0 {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, req.Payload); err == nil {
+				r.add("  Payload", "%s", buf.String())
+			}
+		}
+	}
+	if len(p.Requests) == 0 && p.Transport != "local" {
+		r.add("Requests", "none")
+	}
+	return r.String()
+}
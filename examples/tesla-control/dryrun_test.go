@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "private.key")
+	if err := os.WriteFile(keyFile, []byte("placeholder"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TESLA_KEY_FILE", keyFile)
+	t.Setenv("TESLA_VIN", "5YJ3E1EA7KF123456")
+
+	testCases := []struct {
+		args   []string
+		domain string
+		action string
+	}{
+		{args: []string{"charging-set-limit", "80"}, domain: "infotainment", action: "vehicleAction.chargingSetLimitAction"},
+		{args: []string{"lock"}, domain: "vcsec", action: "RKEAction"},
+		{args: []string{"state", "climate"}, domain: "infotainment", action: "vehicleAction.getVehicleData.getClimateState"},
+	}
+	for _, test := range testCases {
+		r := newResult(test.args[0])
+		if err := dryRun(withResult(context.Background(), r), test.args); err != nil {
+			t.Errorf("dry run of %q failed: %s", test.args, err)
+			continue
+		}
+		plan, ok := r.Response.(dryRunPlan)
+		if !ok || len(plan.Requests) != 1 {
+			t.Errorf("dry run of %q gave unexpected plan %+v", test.args, r.Response)
+			continue
+		}
+		if req := plan.Requests[0]; req.Domain != test.domain || req.Action != test.action {
+			t.Errorf("dry run of %q sent %s to %s, expected %s to %s", test.args, req.Action, req.Domain, test.action, test.domain)
+		}
+		if !plan.WakeRequired {
+			t.Errorf("dry run of %q should require a wake", test.args)
+		}
+	}
+}
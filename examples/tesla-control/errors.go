@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+var (
+	ErrAuthExpired  = errors.New("authorization expired")
+	ErrMissingScope = errors.New("token is missing a required scope")
+	ErrRateLimited  = errors.New("rate limited by the Fleet API")
+)
+
+// errorClass is a kind of failure. The name appears as error_class in JSON results and the exit
+// status is returned by commands that fail with it; both are stable for use in scripts.
+type errorClass struct {
+	name  string
+	exit  int
+	hint  string
+	match func(error) bool
+}
+
+// Exit status of a failure that fits no class.
+const exitError = 1
+
+// errorClasses are tried in order, so more specific classes come first. Exit status 2 is
+// exitPartialFailure.
+var errorClasses = []errorClass{
+	{name: "invalid_arguments", exit: 3, hint: "Run with -h, or help COMMAND, for usage", match: isError(ErrCommandLineArgs)},
+	{name: "unknown_command", exit: 4, hint: "Run with -h for the list of commands", match: isError(ErrUnknownCommand)},
+	{name: "invalid_request", exit: 5, match: isError(ErrInvalidRequest)},
+	{name: "cancelled", exit: 6, match: isError(context.Canceled)},
+	{name: "auth_expired", exit: 7, hint: "Sign in again by running a command interactively", match: isAuthExpired},
+	{name: "missing_scope", exit: 8, hint: "Sign in again and grant the scopes the command needs, such as vehicle_cmds", match: isMissingScope},
+	{name: "rate_limited", exit: 9, hint: "Wait before retrying, or send fewer requests", match: isRateLimited},
+	{name: "key_not_paired", exit: 10, hint: "Pair the public key with the vehicle using add-key-request", match: isError(protocol.ErrKeyNotPaired)},
+	{name: "no_session", exit: 11, hint: "Set TESLA_KEY_FILE to the private key paired with the vehicle", match: isNoSession},
+	{name: "vehicle_asleep", exit: 12, hint: "Allow waking with -allow-wake, or wait longer with -wake-timeout", match: isVehicleAsleep},
+	{name: "command_rejected", exit: 13, hint: "The vehicle refused the command in its current state", match: isCommandRejected},
+	{name: "may_have_succeeded", exit: 14, hint: "Check the vehicle state before retrying, or run with -verify", match: protocol.MayHaveSucceeded},
+	{name: "timeout", exit: 15, hint: "Increase -command-timeout or -connect-timeout", match: isError(context.DeadlineExceeded)},
+	{name: "not_confirmed", exit: 16, hint: "The vehicle accepted the command, but its state did not change", match: isError(ErrNotConfirmed)},
+	{name: "vin_required", exit: 17, hint: "Select a vehicle with -vin or TESLA_VIN, or run vehicles use NAME", match: isError(ErrRequiresVIN)},
+}
+
+// errorGeneric is the class of failures that fit no other class.
+var errorGeneric = errorClass{name: "error", exit: exitError}
+
+// classify returns the class of err, which must not be nil.
+func classify(err error) errorClass {
+	for _, c := range errorClasses {
+		if c.match(err) {
+			return c
+		}
+	}
+	return errorGeneric
+}
+
+// exitStatus returns the exit status of a run whose commands failed with errs: zero if there were
+// none, the class's status if they all share a class, and exitError otherwise.
+func exitStatus(errs []error) int {
+	status := 0
+	for _, err := range errs {
+		switch code := classify(err).exit; {
+		case status == 0:
+			status = code
+		case status != code:
+			return exitError
+		}
+	}
+	return status
+}
+
+func isError(target error) func(error) bool {
+	return func(err error) bool { return errors.Is(err, target) }
+}
+
+// account.Account reports Fleet API failures only as text, such as "http error when sending
+// command to URL: 401 Unauthorized".
+var httpStatusRegex = regexp.MustCompile(`http error when sending command to \S+: (\d{3})`)
+
+// httpStatus returns the HTTP status code of a failed Fleet API request, or zero.
+func httpStatus(err error) int {
+	var httpErr *inet.HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	if m := httpStatusRegex.FindStringSubmatch(err.Error()); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return code
+	}
+	return 0
+}
+
+func isAuthExpired(err error) bool {
+	return errors.Is(err, ErrAuthExpired) || httpStatus(err) == http.StatusUnauthorized
+}
+
+func isMissingScope(err error) bool {
+	return errors.Is(err, ErrMissingScope) || httpStatus(err) == http.StatusForbidden
+}
+
+func isRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited) || httpStatus(err) == http.StatusTooManyRequests
+}
+
+func isNoSession(err error) bool {
+	return errors.Is(err, protocol.ErrNoSession) || errors.Is(err, ErrRequiresPrivateKey)
+}
+
+func isVehicleAsleep(err error) bool {
+	return errors.Is(err, ErrVehicleAsleep) || errors.Is(err, inet.ErrVehicleNotAwake)
+}
+
+// isCommandRejected reports whether the vehicle authenticated the command but declined to
+// execute it.
+func isCommandRejected(err error) bool {
+	var vcsecErr *protocol.NominalVCSECError
+	return protocol.IsNominalError(err) || errors.As(err, &vcsecErr)
+}
+
+// exitCodesText documents the exit statuses in the usage message.
+func exitCodesText() string {
+	text := fmt.Sprintf("  %3d  success\n  %3d  %s\n  %3d  partial_failure (some of the vehicles selected with -vin)\n", 0, exitError, errorGeneric.name, exitPartialFailure)
+	for _, c := range errorClasses {
+		text += fmt.Sprintf("  %3d  %s\n", c.exit, c.name)
+	}
+	return text
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+func TestClassify(t *testing.T) {
+	testCases := []struct {
+		err   error
+		class string
+	}{
+		{fmt.Errorf("%w: bad PERCENT", ErrCommandLineArgs), "invalid_arguments"},
+		{fmt.Errorf("%w: failed to refresh token: %w", ErrAuthExpired, errors.New("bad grant")), "auth_expired"},
+		{errors.New("http error when sending command to https://example.com/api/1/vehicles: 401 Unauthorized"), "auth_expired"},
+		{&inet.HttpError{Code: 403, Message: "missing scopes"}, "missing_scope"},
+		{&inet.HttpError{Code: 429}, "rate_limited"},
+		{fmt.Errorf("lock: %w", protocol.ErrKeyNotPaired), "key_not_paired"},
+		{ErrRequiresPrivateKey, "no_session"},
+		{ErrRequiresVIN, "vin_required"},
+		{inet.ErrVehicleNotAwake, "vehicle_asleep"},
+		{fmt.Errorf("%w (asleep) after waiting 1m0s", ErrVehicleAsleep), "vehicle_asleep"},
+		{&protocol.NominalError{Details: errors.New("already unlocked")}, "command_rejected"},
+		{context.DeadlineExceeded, "timeout"},
+		{context.Canceled, "cancelled"},
+		{errors.New("something else"), "error"},
+	}
+	for _, test := range testCases {
+		if class := classify(test.err).name; class != test.class {
+			t.Errorf("%v: got %s, expected %s", test.err, class, test.class)
+		}
+	}
+}
+
+func TestExitCodesUnique(t *testing.T) {
+	seen := map[int]string{0: "success", exitError: errorGeneric.name, exitPartialFailure: "partial_failure"}
+	for _, c := range errorClasses {
+		if other, ok := seen[c.exit]; ok {
+			t.Errorf("%s and %s share exit status %d", c.name, other, c.exit)
+		}
+		seen[c.exit] = c.name
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	timeout := classify(context.DeadlineExceeded).exit
+	if status := exitStatus(nil); status != 0 {
+		t.Errorf("got %d with no failures", status)
+	}
+	if status := exitStatus([]error{context.DeadlineExceeded, context.DeadlineExceeded}); status != timeout {
+		t.Errorf("got %d for timeouts, expected %d", status, timeout)
+	}
+	if status := exitStatus([]error{context.DeadlineExceeded, ErrCommandLineArgs}); status != exitError {
+		t.Errorf("got %d for mixed failures, expected %d", status, exitError)
+	}
+}
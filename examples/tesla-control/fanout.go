@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/inindev/tesla_utils/auth"
+)
+
+// vinAll selects every vehicle on the account.
+const vinAll = "all"
+
+// Exit status when a command succeeded on some vehicles but not others.
+const exitPartialFailure = 2
+
+// Number of vehicles a command runs against at once, set with -parallel.
+var parallelism = 4
+
+// fanOutReport is the response of a command run against several vehicles.
+type fanOutReport struct {
+	Succeeded int       `json:"succeeded"`
+	Failed    int       `json:"failed"`
+	Vehicles  []*Result `json:"vehicles"`
+}
+
+// selectVehicles expands -vin, which may name an alias, a list, a group or "all". A selection of
+// one vehicle replaces the -vin value, so that commands see a plain VIN.
+func selectVehicles(accountVINs func() ([]string, error)) ([]string, error) {
+	if vinFlag == "" {
+		return nil, nil
+	}
+	groups, err := auth.GetGroups()
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := auth.GetAliases()
+	if err != nil {
+		return nil, err
+	}
+	vins, err := resolveVINs(vinFlag, groups, aliases, accountVINs)
+	if err != nil {
+		return nil, err
+	}
+	if len(vins) == 1 {
+		vinFlag = vins[0]
+	}
+	return vins, nil
+}
+
+// resolveVINs expands a -vin value into VINs. The value is a comma-separated list whose items are
+// VINs, aliases from TESLA_ALIASES, group names from TESLA_GROUPS or "all". Groups may list
+// aliases. Duplicates are removed, keeping the first occurrence. accountVINs is only called if
+// "all" is used.
+func resolveVINs(spec string, groups map[string][]string, aliases map[string]string, accountVINs func() ([]string, error)) ([]string, error) {
+	var vins []string
+	seen := make(map[string]bool)
+	add := func(vin string) error {
+		if alias, ok := aliases[vin]; ok {
+			vin = alias
+		}
+		vin = strings.ToUpper(vin)
+		if err := auth.ValidateVin(vin); err != nil {
+			return fmt.Errorf("%w: %s", err, vin)
+		}
+		if !seen[vin] {
+			seen[vin] = true
+			vins = append(vins, vin)
+		}
+		return nil
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		switch members, isGroup := groups[item]; {
+		case item == "":
+			continue
+		case item == vinAll:
+			all, err := accountVINs()
+			if err != nil {
+				return nil, fmt.Errorf("failed to list vehicles on the account: %w", err)
+			}
+			for _, vin := range all {
+				if err := add(vin); err != nil {
+					return nil, err
+				}
+			}
+		case isGroup:
+			for _, member := range members {
+				if err := add(member); err != nil {
+					return nil, fmt.Errorf("group %s: %w", item, err)
+				}
+			}
+		default:
+			if err := add(item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(vins) == 0 {
+		return nil, errors.New("no vehicles selected")
+	}
+	return vins, nil
+}
+
+// runFanOut runs args against each vehicle, at most parallelism at a time, and responds with an
+// aggregated report. Each vehicle gets its own connection and command timeouts. The exit status is
+// zero if the command succeeded everywhere, exitPartialFailure if it succeeded somewhere and
+// otherwise that of the failures, as computed by exitStatus.
+func runFanOut(ctx context.Context, vins []string, args []string, connTimeout, commandTimeout time.Duration) int {
+	result := newResult(args[0])
+	report := fanOutReport{Vehicles: make([]*Result, len(vins))}
+
+	limit := parallelism
+	if dryRunMode || limit < 1 {
+		limit = 1 // dry runs temporarily replace the default HTTP transport
+	}
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, vin := range vins {
+		wg.Add(1)
+		go func(i int, vin string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			report.Vehicles[i] = runOnVehicle(ctx, vin, args, connTimeout, commandTimeout)
+		}(i, vin)
+	}
+	wg.Wait()
+
+	var failures []error
+	for _, r := range report.Vehicles {
+		if r.Success {
+			report.Succeeded++
+		} else {
+			report.Failed++
+			failures = append(failures, r.err)
+		}
+	}
+	var err error
+	if report.Failed > 0 {
+		err = fmt.Errorf("%s failed on %d of %d vehicles", args[0], report.Failed, len(vins))
+	}
+	respond(withResult(context.Background(), result), report, report.text())
+	result.finish(err)
+	writeResult(os.Stdout, result)
+
+	switch {
+	case report.Failed == 0:
+		return 0
+	case report.Succeeded > 0:
+		return exitPartialFailure
+	}
+	return exitStatus(failures)
+}
+
+// runOnVehicle runs args against vin over a session of its own. Connection failures are recorded
+// in the result.
+func runOnVehicle(ctx context.Context, vin string, args []string, connTimeout, commandTimeout time.Duration) *Result {
+	r := newResult(args[0])
+	r.VIN = vin
+
+	var sess *session
+	if !dryRunMode {
+		sess = newSession(vin, connTimeout)
+		defer sess.close()
+	}
+	r.run(ctx, sess, args, commandTimeout)
+	if !r.Success {
+		log.Printf("%s (%s): %s", vin, r.ErrorClass, r.err)
+	}
+	return r
+}
+
+func (f *fanOutReport) text() string {
+	var buf bytes.Buffer
+	for _, r := range f.Vehicles {
+		if r.text != "" {
+			fmt.Fprintf(&buf, "== %s ==\n%s\n\n", r.VIN, r.text)
+		}
+	}
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VIN\tSTATUS\tDURATION\tERROR")
+	for _, r := range f.Vehicles {
+		status := lineOK
+		if !r.Success {
+			status = lineFailed
+		}
+		duration := (time.Duration(r.DurationMs) * time.Millisecond).String()
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.VIN, status, duration, r.Error)
+	}
+	w.Flush()
+	fmt.Fprintf(&buf, "%d succeeded, %d failed", f.Succeeded, f.Failed)
+	return buf.String()
+}
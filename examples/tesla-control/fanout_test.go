@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestResolveVINs(t *testing.T) {
+	const (
+		vin1 = "5YJ3E1EA7KF123456"
+		vin2 = "7SAYGDEE1PA000001"
+		vin3 = "LRW3E7FA9MC000002"
+	)
+	groups := map[string][]string{"family": {vin1, "blue-y"}}
+	aliases := map[string]string{"blue-y": vin2}
+	account := func() ([]string, error) { return []string{vin2, vin3}, nil }
+
+	testCases := []struct {
+		spec     string
+		expected []string
+	}{
+		{spec: vin1, expected: []string{vin1}},
+		{spec: vin3 + "," + vin1, expected: []string{vin3, vin1}},
+		{spec: "family", expected: []string{vin1, vin2}},
+		{spec: "family, " + vin3 + ",," + vin1, expected: []string{vin1, vin2, vin3}},
+		{spec: "all", expected: []string{vin2, vin3}},
+		{spec: "5yj3e1ea7kf123456", expected: []string{vin1}},
+		{spec: "blue-y", expected: []string{vin2}},
+	}
+	for _, test := range testCases {
+		vins, err := resolveVINs(test.spec, groups, aliases, account)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.spec, err)
+		} else if !reflect.DeepEqual(vins, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.spec, vins, test.expected)
+		}
+	}
+
+	for _, spec := range []string{"", ",", "nosuchgroup", vin1 + ",5YJ3E1EA7KF12345O"} {
+		if _, err := resolveVINs(spec, groups, aliases, account); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+
+	offline := errors.New("offline")
+	if _, err := resolveVINs("all", groups, aliases, func() ([]string, error) { return nil, offline }); !errors.Is(err, offline) {
+		t.Errorf("expected account error, got %v", err)
+	}
+}
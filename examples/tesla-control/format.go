@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+// Template selected with -format. When set, it replaces the output of commands that produce a
+// JSON response.
+var formatTemplate *template.Template
+
+var templateFuncs = template.FuncMap{
+	// unit conversion
+	"c2f":     func(v interface{}) float64 { return toFloat(v)*9/5 + 32 },
+	"f2c":     func(v interface{}) float64 { return (toFloat(v) - 32) * 5 / 9 },
+	"mi2km":   func(v interface{}) float64 { return toFloat(v) * kmPerMile },
+	"km2mi":   func(v interface{}) float64 { return toFloat(v) / kmPerMile },
+	"bar2psi": func(v interface{}) float64 { return toFloat(v) * psiPerBar },
+	"psi2bar": func(v interface{}) float64 { return toFloat(v) / psiPerBar },
+	"round":   roundTo,
+
+	// durations and times
+	"seconds":  func(v interface{}) time.Duration { return time.Duration(toFloat(v) * float64(time.Second)) },
+	"minutes":  func(v interface{}) time.Duration { return time.Duration(toFloat(v) * float64(time.Minute)) },
+	"hours":    func(v interface{}) time.Duration { return time.Duration(toFloat(v) * float64(time.Hour)) },
+	"unixtime": unixTime,
+	"since":    func(v interface{}) time.Duration { return time.Since(unixTime(v)).Round(time.Second) },
+
+	// structure
+	"table": renderTable,
+	"json":  toJSON,
+	"keys":  sortedKeys,
+
+	// strings
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"join":    joinValues,
+	"default": func(def, v interface{}) interface{} { return defaultValue(def, v) },
+}
+
+const (
+	kmPerMile = 1.609344
+	psiPerBar = 14.5038
+)
+
+// parseFormat compiles the -format template.
+func parseFormat(text string) (*template.Template, error) {
+	t, err := template.New("format").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -format template: %w", err)
+	}
+	return t, nil
+}
+
+// templateData converts a command response into plain maps and slices for templates. Fleet API
+// replies wrap their payload in {"response": ...}; the wrapper is removed so that templates can
+// refer to fields directly.
+func templateData(response interface{}) (interface{}, error) {
+	raw, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	if m, ok := data.(map[string]interface{}); ok {
+		if inner, ok := m["response"]; ok && inner != nil {
+			return inner, nil
+		}
+	}
+	return data, nil
+}
+
+// applyFormat renders response using t.
+func applyFormat(t *template.Template, response interface{}) (string, error) {
+	data, err := templateData(response)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
+
+// roundTo rounds v to the given number of decimal places.
+func roundTo(places int, v interface{}) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(toFloat(v)*scale) / scale
+}
+
+// unixTime accepts timestamps in seconds or milliseconds; the Fleet API uses both.
+func unixTime(v interface{}) time.Time {
+	ts := int64(toFloat(v))
+	if ts > 1e12 {
+		return time.UnixMilli(ts)
+	}
+	return time.Unix(ts, 0)
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	return string(data), err
+}
+
+func sortedKeys(v interface{}) []string {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinValues(sep string, v interface{}) string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	parts := make([]string, len(list))
+	for i, item := range list {
+		parts[i] = fmt.Sprint(item)
+	}
+	return strings.Join(parts, sep)
+}
+
+func defaultValue(def, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	if s, ok := v.(string); ok && s == "" {
+		return def
+	}
+	return v
+}
+
+// renderTable lays out a list of objects as aligned columns. If no columns are given, the keys of
+// the first row are used.
+func renderTable(rows interface{}, columns ...string) (string, error) {
+	list, ok := rows.([]interface{})
+	if !ok {
+		if rows == nil {
+			return "", nil
+		}
+		list = []interface{}{rows}
+	}
+	if len(columns) == 0 && len(list) > 0 {
+		columns = sortedKeys(list[0])
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = strings.ToUpper(col)
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range list {
+		m, ok := row.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("table row is not an object: %v", row)
+		}
+		cells := make([]string, len(columns))
+		for i, col := range columns {
+			if val, ok := m[col]; ok && val != nil {
+				cells[i] = fmt.Sprint(val)
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyFormat(t *testing.T) {
+	reply := json.RawMessage(`{"response":{"charge_state":{"battery_level":81,"est_battery_range":201.5},"vehicles":[{"vin":"A1","state":"online"},{"vin":"B2","state":"asleep"}]}}`)
+	testCases := []struct {
+		format string
+		output string
+	}{
+		{format: "{{.charge_state.battery_level}}", output: "81"},
+		{format: "{{round 1 (mi2km .charge_state.est_battery_range)}}", output: "324.3"},
+		{format: "{{.missing}}", output: "<no value>"},
+		{format: "{{table .vehicles \"vin\" \"state\"}}", output: "VIN  STATE\nA1   online\nB2   asleep"},
+		{format: "{{minutes 90}}", output: "1h30m0s"},
+		{format: "{{round 0 (c2f 21)}}", output: "70"},
+	}
+	for _, test := range testCases {
+		tmpl, err := parseFormat(test.format)
+		if err != nil {
+			t.Fatalf("failed to parse '%s': %s", test.format, err)
+		}
+		output, err := applyFormat(tmpl, reply)
+		if err != nil {
+			t.Errorf("format '%s' gave unexpected error %s", test.format, err)
+		} else if output != test.output {
+			t.Errorf("format '%s' gave '%s' instead of '%s'", test.format, output, test.output)
+		}
+	}
+}
+
+func TestParseFormatError(t *testing.T) {
+	if _, err := parseFormat("{{.unterminated"); err == nil {
+		t.Errorf("expected error for malformed template")
+	}
+}
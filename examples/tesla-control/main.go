@@ -2,19 +2,16 @@ package main
 
 import (
 	"context"
-	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/inindev/tesla_utils/auth"
-	"github.com/teslamotors/vehicle-command/pkg/account"
-	"github.com/teslamotors/vehicle-command/pkg/protocol"
-	"github.com/teslamotors/vehicle-command/pkg/vehicle"
 )
 
 func writeErr(format string, a ...interface{}) {
@@ -29,6 +26,8 @@ const usage = `
 
 func Usage() {
 	fmt.Printf("Usage: %s [OPTION...] COMMAND [ARG...]\n", os.Args[0])
+	fmt.Printf("   or: %s [OPTION...] -f SCRIPT\n", os.Args[0])
+	fmt.Printf("   or: %s [OPTION...] %s\n", os.Args[0], rpcCommand)
 	fmt.Printf("\nRun %s help COMMAND for more information. Valid COMMANDs are listed below.", os.Args[0])
 	fmt.Println("")
 	fmt.Println(usage)
@@ -37,6 +36,7 @@ func Usage() {
 	fmt.Printf("Available OPTIONs:\n")
 	flag.PrintDefaults()
 	fmt.Println("")
+	fmt.Printf("Exit statuses:\n%s\n", exitCodesText())
 	fmt.Printf("Available COMMANDs:\n")
 	maxLength := 0
 	var labels []string
@@ -53,31 +53,58 @@ func Usage() {
 	}
 }
 
-func runCommand(acct *account.Account, car *vehicle.Vehicle, args []string, timeout time.Duration) int {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	if err := execute(ctx, acct, car, args); err != nil {
-		if protocol.MayHaveSucceeded(err) {
-			log.Printf("Couldn't verify success: %s", err)
-		} else if errors.Is(err, protocol.ErrNoSession) {
-			log.Printf("You must provide a private key with -key-name or -key-file to execute this command")
-		} else {
-			log.Printf("Failed to execute command: %s", err)
-		}
-		return 1
+// profileUnits returns the units preference from the environment or config file.
+func profileUnits() string {
+	u, err := auth.GetUnits()
+	if err != nil {
+		log.Printf("Ignoring units preference: %s", err)
 	}
-	return 0
+	return u
+}
+
+var (
+	showQR     bool   // render oauth and pairing links as terminal qr codes
+	vinFlag    string // set with -vin, overrides TESLA_VIN
+	dryRunMode bool   // describe commands instead of sending them
+	noPrompt   bool   // stdin carries requests, so never prompt for an authorization code
+)
+
+// configuredVIN returns the VIN selected with -vin, or TESLA_VIN from the profile.
+func configuredVIN() (string, error) {
+	if vinFlag != "" {
+		return vinFlag, nil
+	}
+	return auth.GetVin()
+}
+
+// runCommand runs args and returns the exit status of its error class.
+func runCommand(ctx context.Context, s *session, args []string, timeout time.Duration) int {
+	r := invoke(ctx, s, args, timeout)
+	if r.err == nil {
+		return 0
+	}
+	if r.MayHaveSucceeded {
+		log.Printf("Couldn't verify success (%s): %s", r.ErrorClass, r.err)
+	} else {
+		log.Printf("Failed to execute command (%s): %s", r.ErrorClass, r.err)
+	}
+	if r.Hint != "" {
+		log.Printf("Hint: %s", r.Hint)
+	}
+	return r.ExitCode
 }
 
-func runInteractiveShell(acct *account.Account, car *vehicle.Vehicle, timeout time.Duration) int {
-	InteractiveCommandBuilding(acct, car)
+func runInteractiveShell(ctx context.Context, s *session, timeout time.Duration) int {
+	InteractiveCommandBuilding(ctx, s, timeout)
 	return 0
 }
 
 // handles the authentication process
 func authenticate() (auth.AuthData, error) {
 	authData, err := loadAuthData()
+	if err != nil && noPrompt {
+		return auth.AuthData{}, fmt.Errorf("%w: %w; run %s interactively to sign in", ErrAuthExpired, err, os.Args[0])
+	}
 	if err != nil {
 		log.Println("authentication token not found or expired, initiating new authentication sequence")
 
@@ -87,10 +114,16 @@ func authenticate() (auth.AuthData, error) {
 			return auth.AuthData{}, fmt.Errorf("failed to generate OAuth URL: %w", err)
 		}
 
-		fmt.Printf("\n%s\n%s\n%s\n\n", state, strings.Repeat("~", len(state)), oauthURL)
+		// prompts go to stderr so that stdout carries only command output, even when signing in
+		fmt.Fprintf(os.Stderr, "\n%s\n%s\n%s\n\n", state, strings.Repeat("~", len(state)), oauthURL)
+		if showQR {
+			if code, err := auth.RenderQR(oauthURL); err == nil {
+				fmt.Fprintln(os.Stderr, code)
+			}
+		}
 
 		var authCode string
-		fmt.Print("enter the authorization code from the Tesla authentication page: ")
+		fmt.Fprint(os.Stderr, "enter the authorization code from the Tesla authentication page: ")
 		fmt.Scanln(&authCode)
 
 		authData, err = auth.GetAuthToken(authCode)
@@ -123,7 +156,7 @@ func loadAuthData() (auth.AuthData, error) {
 func refreshToken(refreshToken string) (auth.AuthData, error) {
 	newAuth, err := auth.RefreshAuthToken(refreshToken)
 	if err != nil {
-		return auth.AuthData{}, fmt.Errorf("failed to refresh token: %w", err)
+		return auth.AuthData{}, fmt.Errorf("%w: failed to refresh token: %w", ErrAuthExpired, err)
 	}
 	if err := auth.SaveAuthData(newAuth); err != nil {
 		return auth.AuthData{}, fmt.Errorf("failed to save refreshed auth data: %w", err)
@@ -142,15 +175,60 @@ func main() {
 		forceBLE       bool
 		commandTimeout time.Duration
 		connTimeout    time.Duration
+		format         string
+		scriptFile     string
 	)
 
+	wakePolicy = profileWakePolicy()
 	flag.Usage = Usage
 	flag.BoolVar(&debug, "debug", false, "Enable verbose debugging messages")
 	flag.BoolVar(&forceBLE, "ble", false, "Force BLE connection even if OAuth environment variables are defined")
 	flag.DurationVar(&commandTimeout, "command-timeout", 5*time.Second, "Set timeout for commands sent to the vehicle.")
 	flag.DurationVar(&connTimeout, "connect-timeout", 45*time.Second, "Set timeout for establishing initial connection.")
+	flag.BoolVar(&showQR, "qr", auth.QRRequested(), "Show OAuth and pairing links as QR codes (or set TESLA_QR, TESLA_QR=light for light terminals)")
+	flag.StringVar(&outputMode, "output", outputText, "Output format: text or json (one JSON object per command)")
+	flag.StringVar(&units, "units", profileUnits(), "Display units for state and temperatures: metric or imperial (or set TESLA_UNITS)")
+	flag.StringVar(&vinFlag, "vin", "", "Vehicle VIN, comma-separated VINs, a group from TESLA_GROUPS or 'all' (defaults to TESLA_VIN)")
+	flag.IntVar(&parallelism, "parallel", parallelism, "Number of vehicles to run a command against at once when -vin selects several")
+	flag.BoolVar(&verifyMode, "verify", false, "Read back the vehicle state after commands that change it, and resend idempotent commands that did not take effect")
+	flag.BoolVar(&dryRunMode, "dry-run", false, "Validate commands and print what would be sent without using the network")
+	flag.StringVar(&scriptFile, "f", "", "Run commands from a script file over one session (- reads standard input)")
+	flag.BoolVar(&wakePolicy.Allow, "allow-wake", wakePolicy.Allow, "Wake the vehicle if it is asleep; otherwise commands that need it online fail (or set TESLA_WAKE)")
+	flag.DurationVar(&wakePolicy.MaxWait, "wake-timeout", wakePolicy.MaxWait, "Maximum time to wait for the vehicle to come online")
+	flag.DurationVar(&wakePolicy.Backoff, "wake-backoff", wakePolicy.Backoff, "Initial delay between vehicle state checks while waiting, doubled after each check")
+	flag.Float64Var(&wakePolicy.Jitter, "wake-jitter", wakePolicy.Jitter, "Fraction of each wait delay that is randomized, from 0 to 1")
+	flag.BoolVar(&useSessionCache, "session-cache", useSessionCache, "Reuse vehicle sessions from earlier runs, saved in "+auth.SessionFilePath())
+	flag.StringVar(&format, "format", "", "Go template applied to JSON responses, e.g. '{{.charge_state.battery_level}}'")
 
 	flag.Parse()
+	if flag.Arg(0) == completeCommand && flag.NArg() > 1 {
+		words := flag.Args()[1:]
+		for _, candidate := range completeWords(words[:len(words)-1], words[len(words)-1]) {
+			fmt.Println(candidate)
+		}
+		status = 0
+		return
+	}
+	if err := checkOutputMode(outputMode); err != nil {
+		writeErr("%s", err)
+		return
+	}
+	if err := auth.ValidateWakePolicy(wakePolicy); err != nil {
+		writeErr("%s", err)
+		return
+	}
+	if err := auth.ValidateUnits(units); err != nil {
+		writeErr("%s", err)
+		return
+	}
+	units = strings.ToLower(units)
+	if format != "" {
+		var err error
+		if formatTemplate, err = parseFormat(format); err != nil {
+			writeErr("%s", err)
+			return
+		}
+	}
 	if !debug {
 		if debugEnv, ok := os.LookupEnv("TESLA_VERBOSE"); ok {
 			debug = debugEnv != "false" && debugEnv != "0"
@@ -162,8 +240,69 @@ func main() {
 		log.SetFlags(log.LstdFlags)
 	}
 
+	// setupFailed reports errors that occur before the command runs and sets the exit status of
+	// their class. In JSON mode, the failure is also written as the command's result so that
+	// scripts always receive one object.
+	setupFailed := func(format string, a ...interface{}) {
+		err := fmt.Errorf(format, a...)
+		class := classify(err)
+		log.Printf("Error (%s): %s", class.name, err)
+		if class.hint != "" && outputMode == outputText {
+			log.Printf("Hint: %s", class.hint)
+		}
+		status = class.exit
+		if outputMode == outputJSON && flag.NArg() > 0 {
+			r := newResult(flag.Arg(0))
+			r.finish(err)
+			writeResult(os.Stdout, r)
+		}
+	}
+
 	args := flag.Args()
-	if len(args) > 0 {
+	if scriptFile == "" && len(args) == 0 && stdinIsPipe() {
+		scriptFile = "-"
+	}
+
+	// read and validate the whole script before connecting to the vehicle
+	var script []scriptLine
+	if scriptFile != "" {
+		if len(args) > 0 {
+			writeErr("Cannot combine -f with a command on the command line")
+			return
+		}
+		r, err := openScript(scriptFile)
+		if err != nil {
+			writeErr("Error opening script: %s", err)
+			return
+		}
+		script, err = parseScript(r, os.LookupEnv)
+		r.Close()
+		if err != nil {
+			writeErr("Invalid script:\n%s", err)
+			return
+		}
+	}
+
+	// in rpc mode, requests arrive on stdin and responses are always JSON
+	rpcMode := len(args) > 0 && args[0] == rpcCommand
+	if rpcMode {
+		if len(args) > 1 || scriptFile != "" {
+			writeErr("Usage: %s [OPTION...] %s", os.Args[0], rpcCommand)
+			return
+		}
+		outputMode, formatTemplate, noPrompt = outputJSON, nil, true
+	}
+
+	// SIGTERM cancels whatever is running, after which the session is closed as usual. So does
+	// Ctrl-C, except in the interactive shell, where it cancels only the command in flight.
+	signals := []os.Signal{syscall.SIGTERM}
+	if len(args) > 0 || scriptFile != "" {
+		signals = append(signals, os.Interrupt)
+	}
+	ctx, stop := signalContext(context.Background(), signals...)
+	defer stop()
+
+	if len(args) > 0 && !rpcMode {
 		if args[0] == "help" {
 			if len(args) == 1 {
 				Usage()
@@ -178,111 +317,86 @@ func main() {
 			status = 0
 			return
 		}
-	}
-
-	// load authentication data
-	authData, err := loadAuthData()
-	if err != nil {
-		log.Printf("Error loading credentials: %v", err)
-		return
-	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), connTimeout)
-	defer cancel()
+		// reject unknown commands and bad arguments before connecting to the vehicle
+		info, ok := commands[args[0]]
+		if !ok {
+			setupFailed("%w: %s", ErrUnknownCommand, args[0])
+			return
+		}
+		if _, err := info.parseArgs(args[1:]); err != nil {
+			setupFailed("%w", err)
+			if outputMode == outputText {
+				info.Usage(args[0])
+			}
+			return
+		}
 
-	acct, err := account.New(authData.AccessToken, "")
-	if err != nil {
-		log.Printf("Error creating account: %v", err)
-		return
+		// commands such as the catalogue need neither credentials nor a vehicle
+		if info.local {
+			status = runCommand(ctx, nil, args, commandTimeout)
+			return
+		}
 	}
 
-	// Load the private key for vehicle commands if needed
-	keyFile, err := auth.GetKeyFile()
-	if err != nil {
-		log.Printf("Error getting key file path: %v", err)
-		return
+	// The session sets up only what each command needs, when it runs. Dry runs have no session
+	// and never connect.
+	var sess *session
+	if !dryRunMode {
+		sess = newSession("", connTimeout)
+		defer sess.close()
 	}
 
-	privateKey, err := protocol.LoadPrivateKey(keyFile)
+	vins, err := selectVehicles(func() ([]string, error) {
+		if sess == nil {
+			return nil, fmt.Errorf("-vin %s needs the network, which -dry-run does not use", vinAll)
+		}
+		acct, err := sess.account()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(ctx, connTimeout)
+		defer cancel()
+		return listAccountVINs(ctx, acct)
+	})
 	if err != nil {
-		log.Printf("Error loading private key: %v", err)
+		setupFailed("Error selecting vehicles: %w", err)
 		return
 	}
-
-	var car *vehicle.Vehicle
-	vin, err := auth.GetVin()
-	if err == nil && vin != "" {
-		car, err = acct.GetVehicle(ctx, vin, privateKey, nil)
-		if err != nil {
-			log.Printf("Error: GetVehicle failed: %v", err)
+	if len(vins) > 1 {
+		if len(args) == 0 || rpcMode {
+			setupFailed("-vin %s selects %d vehicles, which requires a single COMMAND", vinFlag, len(vins))
 			return
 		}
+		status = runFanOut(ctx, vins, args, connTimeout, commandTimeout)
+		return
+	}
 
-		if err := car.Connect(ctx); err != nil {
-			log.Printf("Error: Connect failed: %v", err)
-			return
-		}
-
-		backoff := time.Second
-		for attempt := 0; attempt < 3; attempt++ {
-			if ctx.Err() != nil {
-				log.Printf("Context timed out or canceled during Wakeup retries: %v", ctx.Err())
-				return
-			}
-			if err := car.Wakeup(ctx); err == nil {
-				log.Printf("Wakeup succeeded on attempt %d", attempt+1)
-				break
-			} else {
-				if strings.Contains(err.Error(), "offline") || strings.Contains(err.Error(), "asleep") {
-					log.Printf("Wakeup failed on attempt %d - vehicle offline or asleep: %v", attempt+1, err)
-				} else {
-					log.Printf("Wakeup failed on attempt %d: %v", attempt+1, err)
-				}
-				if attempt == 2 {
-					log.Println("Failed to wake up vehicle after multiple attempts")
-					return
-				}
-				time.Sleep(backoff)
-				backoff *= 2
-			}
-		}
-
-		backoff = time.Second
-		for attempt := 0; attempt < 5; attempt++ {
-			if ctx.Err() != nil {
-				log.Printf("Context timed out or canceled during StartSession retries: %v", ctx.Err())
+	if sess != nil {
+		sess.vin, _ = configuredVIN()
+		// report missing credentials before connecting
+		if len(args) > 0 && !rpcMode {
+			if err := sess.check(args[0]); err != nil {
+				setupFailed("%w", err)
 				return
 			}
-			if err := car.StartSession(ctx, nil); err == nil {
-				log.Printf("StartSession succeeded on attempt %d", attempt+1)
-				break
-			} else {
-				log.Printf("Error: StartSession failed on attempt %d: %v", attempt+1, err)
-				if attempt == 4 {
-					log.Println("Error: Failed to start session after multiple attempts")
-					return
-				}
-				time.Sleep(backoff)
-				backoff *= 2 // double the wait time for each retry
-			}
-		}
-
-		// before command execution, refresh session if possible
-		//if err := car.RefreshSession(ctx); err != nil {
-		//    log.Printf("Failed to refresh session: %v", err)
-		//    return
-		//}
-
-		if car != nil {
-			defer car.Disconnect()
 		}
 	}
 
-	if flag.NArg() > 0 {
+	if rpcMode {
+		log.Println("serving requests on standard input...")
+		status = runRPC(ctx, sess, os.Stdin, os.Stdout, commandTimeout)
+	} else if scriptFile != "" {
+		log.Printf("running %d script lines...", len(script))
+		status = runScript(ctx, sess, script, commandTimeout)
+	} else if flag.NArg() > 0 {
 		log.Println("attempting to execute command...")
-		status = runCommand(acct, car, flag.Args(), commandTimeout)
+		status = runCommand(ctx, sess, flag.Args(), commandTimeout)
+	} else if dryRunMode {
+		log.Println("dry run: entering interactive shell without connecting...")
+		status = runInteractiveShell(ctx, sess, commandTimeout)
 	} else {
 		log.Println("entering interactive shell...")
-		status = runInteractiveShell(acct, car, commandTimeout)
+		status = runInteractiveShell(ctx, sess, commandTimeout)
 	}
 }
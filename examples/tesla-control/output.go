@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// Output format selected with -output.
+var outputMode = outputText
+
+func checkOutputMode(mode string) error {
+	switch mode {
+	case outputText, outputJSON:
+		return nil
+	}
+	return fmt.Errorf("unsupported output format '%s': expected text or json", mode)
+}
+
+// Result records the outcome of a single command invocation.
+type Result struct {
+	Command          string            `json:"command"`
+	Line             int               `json:"line,omitempty"` // script line, when run with -f
+	VIN              string            `json:"vin,omitempty"`
+	Args             map[string]string `json:"args,omitempty"`
+	Start            time.Time         `json:"start"`
+	DurationMs       int64             `json:"duration_ms"`
+	Success          bool              `json:"success"`
+	MayHaveSucceeded bool              `json:"may_have_succeeded"`
+	ErrorClass       string            `json:"error_class,omitempty"`
+	ExitCode         int               `json:"exit_code,omitempty"` // exit status of the error class
+	Error            string            `json:"error,omitempty"`
+	Hint             string            `json:"hint,omitempty"`         // how to fix the error
+	Verification     string            `json:"verification,omitempty"` // outcome of -verify
+	Attempts         int               `json:"attempts,omitempty"`     // times the command was sent
+	Response         interface{}       `json:"response,omitempty"`
+
+	text string // human-readable form of Response
+	err  error
+}
+
+type resultKey struct{}
+
+func newResult(command string) *Result {
+	return &Result{Command: command, Start: time.Now()}
+}
+
+func withResult(ctx context.Context, r *Result) context.Context {
+	return context.WithValue(ctx, resultKey{}, r)
+}
+
+func resultFromContext(ctx context.Context) *Result {
+	r, _ := ctx.Value(resultKey{}).(*Result)
+	return r
+}
+
+// finish stamps the duration and error details onto r.
+func (r *Result) finish(err error) {
+	r.DurationMs = time.Since(r.Start).Milliseconds()
+	r.err = err
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+		r.MayHaveSucceeded = protocol.MayHaveSucceeded(err)
+		class := classify(err)
+		r.ErrorClass, r.ExitCode, r.Hint = class.name, class.exit, class.hint
+	}
+}
+
+// respond records value as the response of the command running in ctx. In text mode, text is
+// printed instead of value.
+func respond(ctx context.Context, value interface{}, text string) {
+	r := resultFromContext(ctx)
+	if r == nil {
+		fmt.Println(text)
+		return
+	}
+	r.Response = value
+	if r.text != "" {
+		r.text += "\n"
+	}
+	r.text += text
+}
+
+// respondJSON records a raw JSON reply, such as a Fleet API response body.
+func respondJSON(ctx context.Context, reply []byte) {
+	if json.Valid(reply) {
+		respond(ctx, json.RawMessage(reply), string(reply))
+	} else {
+		respond(ctx, string(reply), string(reply))
+	}
+}
+
+// respondProto records a protobuf message from the vehicle along with its text form. Fields use
+// their protobuf (snake_case) names, matching the Fleet API.
+func respondProto(ctx context.Context, msg proto.Message, text string) {
+	options := protojson.MarshalOptions{
+		UseProtoNames:     true,
+		EmitDefaultValues: true,
+	}
+	data, err := options.Marshal(msg)
+	if err != nil {
+		respond(ctx, nil, text)
+		return
+	}
+	respond(ctx, json.RawMessage(data), text)
+}
+
+// writeResult prints r in the selected output format. A -format template takes precedence for
+// commands that produced a response.
+func writeResult(w io.Writer, r *Result) {
+	if formatTemplate != nil && r.Success && r.Response != nil {
+		text, err := applyFormat(formatTemplate, r.Response)
+		if err != nil {
+			writeErr("Error applying -format template: %s", err)
+			return
+		}
+		fmt.Fprintln(w, text)
+		return
+	}
+	if outputMode == outputJSON {
+		data, err := json.Marshal(r)
+		if err != nil {
+			writeErr("Error encoding result: %s", err)
+			return
+		}
+		fmt.Fprintln(w, string(data))
+		return
+	}
+	if r.text != "" {
+		fmt.Fprintln(w, r.text)
+	}
+}
+
+// invoke runs a command and returns its result. The result has already been printed.
+func invoke(ctx context.Context, s *session, args []string, timeout time.Duration) *Result {
+	r := newResult(args[0])
+	r.run(ctx, s, args, timeout)
+	writeResult(os.Stdout, r)
+	return r
+}
+
+// run sets up what the command needs in s, sends args and records the outcome in r. The timeout
+// applies to each attempt at the command, not to connection setup; zero means none.
+func (r *Result) run(ctx context.Context, s *session, args []string, timeout time.Duration) {
+	acct, car, err := s.prepare(ctx, args[0])
+	if car != nil {
+		r.VIN = car.VIN()
+	}
+	if err == nil {
+		err = r.send(ctx, acct, car, args, timeout)
+		if verifyMode && car != nil {
+			err = r.verify(ctx, acct, car, args, timeout, err)
+		}
+	}
+	r.finish(err)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/inindev/tesla_utils/auth"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Display units selected with -units. Defaults to the units preference in the profile.
+var units = auth.UnitsImperial
+
+// stateRenderers produce human-readable text for state categories. Categories without a renderer
+// are printed as protojson.
+var stateRenderers = map[string]func(*report, *carserver.VehicleData){
+	"charge":          renderCharge,
+	"climate":         renderClimate,
+	"closures":        renderClosures,
+	"tire-pressure":   renderTirePressure,
+	"drive":           renderDrive,
+	"location":        renderLocation,
+	"software-update": renderSoftwareUpdate,
+	"media":           renderMedia,
+}
+
+// renderState formats the state category name of data for the terminal.
+func renderState(name string, data *carserver.VehicleData) string {
+	render, ok := stateRenderers[strings.ToLower(name)]
+	if !ok {
+		return protojson.Format(data)
+	}
+	r := &report{}
+	render(r, data)
+	return r.String()
+}
+
+// report collects label/value pairs and lays them out in two aligned columns.
+type report struct {
+	rows [][2]string
+}
+
+func (r *report) add(label string, format string, a ...interface{}) {
+	r.rows = append(r.rows, [2]string{label, fmt.Sprintf(format, a...)})
+}
+
+func (r *report) String() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, row := range r.rows {
+		fmt.Fprintf(w, "%s:\t%s\n", row[0], row[1])
+	}
+	w.Flush()
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func metric() bool {
+	return units == auth.UnitsMetric
+}
+
+func formatTemp(celsius float32) string {
+	if metric() {
+		return fmt.Sprintf("%.1f°C", celsius)
+	}
+	return fmt.Sprintf("%.0f°F", celsius*9/5+32)
+}
+
+func formatDistance(miles float32) string {
+	if metric() {
+		return fmt.Sprintf("%.0f km", float64(miles)*kmPerMile)
+	}
+	return fmt.Sprintf("%.0f mi", miles)
+}
+
+func formatSpeed(mph float32) string {
+	if metric() {
+		return fmt.Sprintf("%.0f km/h", float64(mph)*kmPerMile)
+	}
+	return fmt.Sprintf("%.0f mph", mph)
+}
+
+func formatPressure(bar float32) string {
+	if bar == 0 {
+		return "-"
+	}
+	if metric() {
+		return fmt.Sprintf("%.2f bar", bar)
+	}
+	return fmt.Sprintf("%.1f psi", float64(bar)*psiPerBar)
+}
+
+func formatMinutes(minutes float32) string {
+	return (time.Duration(minutes) * time.Minute).String()
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func openClosed(b bool) string {
+	if b {
+		return "open"
+	}
+	return "closed"
+}
+
+// variantName returns the name of the option set in one of the vehicle's enum-like messages, such
+// as ChargeState_ChargingState, or "unknown" if none is set.
+func variantName(msg proto.Message) string {
+	name := "unknown"
+	if msg == nil || !msg.ProtoReflect().IsValid() {
+		return name
+	}
+	msg.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		name = strings.ToLower(string(fd.Name()))
+		return false
+	})
+	return name
+}
+
+func renderCharge(r *report, data *carserver.VehicleData) {
+	s := data.GetChargeState()
+	r.add("State", "%s", variantName(s.GetChargingState()))
+	r.add("Battery", "%d%% (limit %d%%)", s.GetBatteryLevel(), s.GetChargeLimitSoc())
+	r.add("Range", "%s (estimated %s)", formatDistance(s.GetBatteryRange()), formatDistance(s.GetEstBatteryRange()))
+	r.add("Charge port", "%s, cable %s", openClosed(s.GetChargePortDoorOpen()), variantName(s.GetConnChargeCable()))
+	r.add("Charger", "%d kW, %d V, %d/%d A", s.GetChargerPower(), s.GetChargerVoltage(), s.GetChargerActualCurrent(), s.GetChargeCurrentRequest())
+	r.add("Charge rate", "%s", formatSpeed(s.GetChargeRateMphFloat()))
+	r.add("Energy added", "%.1f kWh (%s)", s.GetChargeEnergyAdded(), formatDistance(s.GetChargeMilesAddedRated()))
+	r.add("Time to full", "%s", formatMinutes(float32(s.GetMinutesToFullCharge())))
+}
+
+func renderClimate(r *report, data *carserver.VehicleData) {
+	s := data.GetClimateState()
+	r.add("Climate", "%s", onOff(s.GetIsClimateOn()))
+	r.add("Inside", "%s", formatTemp(s.GetInsideTempCelsius()))
+	r.add("Outside", "%s", formatTemp(s.GetOutsideTempCelsius()))
+	r.add("Set point", "driver %s, passenger %s", formatTemp(s.GetDriverTempSetting()), formatTemp(s.GetPassengerTempSetting()))
+	r.add("Fan", "%d", s.GetFanStatus())
+	r.add("Defrost", "front %s, rear %s", onOff(s.GetIsFrontDefrosterOn()), onOff(s.GetIsRearDefrosterOn()))
+	r.add("Seat heaters", "left %d, right %d", s.GetSeatHeaterLeft(), s.GetSeatHeaterRight())
+	r.add("Keeper mode", "%s", variantName(s.GetClimateKeeperMode()))
+}
+
+func renderClosures(r *report, data *carserver.VehicleData) {
+	s := data.GetClosuresState()
+	locked := "unlocked"
+	if s.GetLocked() {
+		locked = "locked"
+	}
+	r.add("Doors", "%s", locked)
+	r.add("Driver front", "door %s, window %s", openClosed(s.GetDoorOpenDriverFront()), openClosed(s.GetWindowOpenDriverFront()))
+	r.add("Passenger front", "door %s, window %s", openClosed(s.GetDoorOpenPassengerFront()), openClosed(s.GetWindowOpenPassengerFront()))
+	r.add("Driver rear", "door %s, window %s", openClosed(s.GetDoorOpenDriverRear()), openClosed(s.GetWindowOpenDriverRear()))
+	r.add("Passenger rear", "door %s, window %s", openClosed(s.GetDoorOpenPassengerRear()), openClosed(s.GetWindowOpenPassengerRear()))
+	r.add("Trunk", "front %s, rear %s", openClosed(s.GetDoorOpenTrunkFront()), openClosed(s.GetDoorOpenTrunkRear()))
+	r.add("Sentry mode", "%s", variantName(s.GetSentryModeState()))
+	r.add("Valet mode", "%s", onOff(s.GetValetMode()))
+	r.add("User present", "%t", s.GetIsUserPresent())
+}
+
+func renderTirePressure(r *report, data *carserver.VehicleData) {
+	s := data.GetTirePressureState()
+	tire := func(bar float32, soft, hard bool) string {
+		switch {
+		case hard:
+			return formatPressure(bar) + " (warning)"
+		case soft:
+			return formatPressure(bar) + " (low)"
+		}
+		return formatPressure(bar)
+	}
+	r.add("Front left", "%s", tire(s.GetTpmsPressureFl(), s.GetTpmsSoftWarningFl(), s.GetTpmsHardWarningFl()))
+	r.add("Front right", "%s", tire(s.GetTpmsPressureFr(), s.GetTpmsSoftWarningFr(), s.GetTpmsHardWarningFr()))
+	r.add("Rear left", "%s", tire(s.GetTpmsPressureRl(), s.GetTpmsSoftWarningRl(), s.GetTpmsHardWarningRl()))
+	r.add("Rear right", "%s", tire(s.GetTpmsPressureRr(), s.GetTpmsSoftWarningRr(), s.GetTpmsHardWarningRr()))
+	r.add("Recommended", "front %s, rear %s", formatPressure(s.GetTpmsRcpFrontValue()), formatPressure(s.GetTpmsRcpRearValue()))
+}
+
+func renderDrive(r *report, data *carserver.VehicleData) {
+	s := data.GetDriveState()
+	r.add("Shift state", "%s", variantName(s.GetShiftState()))
+	r.add("Speed", "%s", formatSpeed(s.GetSpeedFloat()))
+	r.add("Power", "%d kW", s.GetPower())
+	r.add("Odometer", "%s", formatDistance(float32(s.GetOdometerInHundredthsOfAMile())/100))
+	if dest := s.GetActiveRouteDestination(); dest != "" {
+		r.add("Destination", "%s", dest)
+		r.add("Arrival", "%s, %s remaining", formatMinutes(s.GetActiveRouteMinutesToArrival()), formatDistance(s.GetActiveRouteMilesToArrival()))
+		r.add("Energy at arrival", "%.1f kWh", s.GetActiveRouteEnergyAtArrival())
+	}
+}
+
+func renderLocation(r *report, data *carserver.VehicleData) {
+	s := data.GetLocationState()
+	if name := s.GetLocationName(); name != "" {
+		r.add("Location", "%s", name)
+	}
+	r.add("Coordinates", "%.6f, %.6f", s.GetLatitude(), s.GetLongitude())
+	r.add("Heading", "%d°", s.GetHeading())
+	if ts := s.GetGpsAsOf(); ts != 0 {
+		r.add("As of", "%s", time.Unix(int64(ts), 0).Format(time.RFC3339))
+	}
+}
+
+func renderSoftwareUpdate(r *report, data *carserver.VehicleData) {
+	s := data.GetSoftwareUpdateState()
+	r.add("Status", "%s", variantName(s.GetStatus()))
+	if version := s.GetVersion(); version != "" {
+		r.add("Version", "%s", version)
+	}
+	r.add("Progress", "download %d%%, install %d%%", s.GetDownloadPerc(), s.GetInstallPerc())
+	r.add("Expected duration", "%s", time.Duration(s.GetExpectedDurationSec())*time.Second)
+	if ts := s.GetScheduledTimeMs(); ts != 0 {
+		r.add("Scheduled", "%s", time.UnixMilli(int64(ts)).Format(time.RFC3339))
+	}
+}
+
+func renderMedia(r *report, data *carserver.VehicleData) {
+	s := data.GetMediaState()
+	status := strings.ToLower(s.GetMediaPlaybackStatus().String())
+	r.add("Playback", "%s", status)
+	source := strings.TrimPrefix(s.GetNowPlayingSource().String(), "MediaSourceType_")
+	r.add("Source", "%s", source)
+	if title := s.GetNowPlayingTitle(); title != "" {
+		r.add("Now playing", "%s - %s", s.GetNowPlayingArtist(), title)
+	}
+	r.add("Volume", "%.1f/%.1f", s.GetAudioVolume(), s.GetAudioVolumeMax())
+	r.add("Remote control", "%t", s.GetRemoteControlEnabled())
+}
+
+// parseTemp reads a temperature such as 70f, 21c or 21.5 and returns it in Celsius. Values without
+// a unit are read in the display units.
+func parseTemp(text string) (float32, error) {
+	text = strings.TrimSpace(text)
+	unit := ""
+	if n := len(text); n > 0 {
+		switch last := strings.ToUpper(text[n-1:]); last {
+		case "C", "F":
+			unit, text = last, strings.TrimSpace(text[:n-1])
+		}
+	}
+	value, err := strconv.ParseFloat(text, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to parse temperature: format as 22C or 72F", ErrCommandLineArgs)
+	}
+	if unit == "" {
+		unit = "F"
+		if metric() {
+			unit = "C"
+		}
+	}
+	degrees := float32(value)
+	if unit == "F" {
+		degrees = (degrees - 32.0) * 5.0 / 9.0
+	}
+	return degrees, nil
+}
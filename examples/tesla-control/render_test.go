@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/inindev/tesla_utils/auth"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestParseTemp(t *testing.T) {
+	defer func(u string) { units = u }(units)
+	testCases := []struct {
+		units   string
+		str     string
+		celsius float32
+		err     error
+	}{
+		{units: auth.UnitsImperial, str: "72F", celsius: 22.22},
+		{units: auth.UnitsImperial, str: "21c", celsius: 21},
+		{units: auth.UnitsImperial, str: "68", celsius: 20},
+		{units: auth.UnitsMetric, str: "21.5", celsius: 21.5},
+		{units: auth.UnitsMetric, str: "70 f", celsius: 21.11},
+		{units: auth.UnitsMetric, str: "warm", err: ErrCommandLineArgs},
+		{units: auth.UnitsMetric, str: "21K", err: ErrCommandLineArgs},
+		{units: auth.UnitsMetric, str: "", err: ErrCommandLineArgs},
+	}
+	for _, test := range testCases {
+		units = test.units
+		celsius, err := parseTemp(test.str)
+		if !errors.Is(err, test.err) {
+			t.Errorf("expected '%s' to result in error %v, but got %v", test.str, test.err, err)
+		} else if math.Abs(float64(celsius-test.celsius)) > 0.01 {
+			t.Errorf("expected parseTemp('%s') = %.2f with %s units, but got %.2f", test.str, test.celsius, test.units, celsius)
+		}
+	}
+}
+
+func TestRenderTirePressure(t *testing.T) {
+	defer func(u string) { units = u }(units)
+	data := &carserver.VehicleData{
+		TirePressureState: &carserver.TirePressureState{
+			OptionalTpmsPressureFl:    &carserver.TirePressureState_TpmsPressureFl{TpmsPressureFl: 2.9},
+			OptionalTpmsSoftWarningFl: &carserver.TirePressureState_TpmsSoftWarningFl{TpmsSoftWarningFl: true},
+		},
+	}
+	units = auth.UnitsImperial
+	if text := renderState("tire-pressure", data); !strings.Contains(text, "42.1 psi (low)") {
+		t.Errorf("expected psi reading in imperial output, got:\n%s", text)
+	}
+	units = auth.UnitsMetric
+	if text := renderState("tire-pressure", data); !strings.Contains(text, "2.90 bar (low)") {
+		t.Errorf("expected bar reading in metric output, got:\n%s", text)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// Attempts at a command before a retryable error is reported.
+const maxAttempts = 3
+
+// Delay before the first retry, doubled after each one.
+const retryBackoff = time.Second
+
+// retryable reports whether err may clear up if the command is sent again: the Fleet API was rate
+// limited or briefly unavailable, the vehicle session had to be resynchronized, or the attempt
+// timed out.
+func retryable(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case protocol.Temporary(err), protocol.MayHaveSucceeded(err), isRateLimited(err):
+		return true
+	case httpStatus(err) == http.StatusServiceUnavailable:
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.Is(err, protocol.ErrBadResponse), errors.Is(err, protocol.ErrNoDecryptionContext), errors.Is(err, protocol.ErrReplayedResponse):
+		return true
+	}
+	return false
+}
+
+// mayHaveExecuted reports whether the vehicle may have acted on a command that failed with err. A
+// timed out attempt may have reached the vehicle.
+func mayHaveExecuted(err error) bool {
+	return protocol.MayHaveSucceeded(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// send executes args, retrying with backoff on retryable errors, and never after a non-retryable
+// one. Idempotent commands are retried on any retryable error; other commands only on those where
+// mayHaveExecuted is false, so that a command the vehicle may have acted on is not repeated. Each
+// attempt gets its own timeout.
+func (r *Result) send(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args []string, timeout time.Duration) error {
+	info := commands[args[0]]
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		r.Attempts = attempt
+		err := withTimeout(ctx, timeout, func(ctx context.Context) error {
+			return execute(withResult(ctx, r), acct, car, args)
+		})
+		switch {
+		case err == nil, attempt == maxAttempts, !retryable(err), ctx.Err() != nil:
+			return err
+		case !info.idempotent && mayHaveExecuted(err):
+			log.Printf("%s may have reached the vehicle and is not safe to repeat, not retrying", args[0])
+			return err
+		}
+		log.Printf("%s failed on attempt %d, retrying in %s: %s", args[0], attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inindev/tesla_utils/auth"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+func TestRetryable(t *testing.T) {
+	testCases := []struct {
+		err       error
+		retryable bool
+		executed  bool
+	}{
+		{&inet.HttpError{Code: 429}, true, false},
+		{errors.New("http error when sending command to https://example.com/api/1/vehicles/x/vehicle_data: 503 Service Unavailable"), true, false},
+		{context.DeadlineExceeded, true, true},
+		{fmt.Errorf("lock: %w", protocol.ErrBadResponse), true, false},
+		{context.Canceled, false, false},
+		{fmt.Errorf("%w: bad PERCENT", ErrCommandLineArgs), false, false},
+		{protocol.ErrKeyNotPaired, false, false},
+	}
+	for _, test := range testCases {
+		if retryable(test.err) != test.retryable {
+			t.Errorf("%v: expected retryable %t", test.err, test.retryable)
+		}
+		if mayHaveExecuted(test.err) != test.executed {
+			t.Errorf("%v: expected may have executed %t", test.err, test.executed)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	for _, name := range []string{"lock", "charging-set-limit", "climate-on", "get-vehicle-data"} {
+		if !commands[name].idempotent {
+			t.Errorf("%s should be idempotent", name)
+		}
+	}
+	for _, name := range []string{"honk", "flash-lights", "trunk-move", "trunk-open", "frunk-open", "media-toggle-playback"} {
+		if commands[name].idempotent {
+			t.Errorf("%s should not be idempotent", name)
+		}
+	}
+}
+
+// trunk-open and frunk-open send the same move as trunk-move, so a send that may have reached the
+// vehicle must not be repeated.
+func TestSendClosureToggle(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "private.key")
+	if _, err := auth.GenerateKeyPair(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	key, err := protocol.LoadPrivateKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	car, err := vehicle.NewVehicle(newDryRunConnector("5YJ3E1EA7KF123456", ""), key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"trunk-open", "frunk-open"} {
+		sends := 0
+		info := commands[name]
+		handler := info.handler
+		info.handler = func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+			sends++
+			return protocol.NewError("response timed out", true, false)
+		}
+
+		r := newResult(name)
+		err := r.send(context.Background(), nil, car, []string{name}, time.Second)
+		info.handler = handler
+		if !protocol.MayHaveSucceeded(err) {
+			t.Errorf("%s: got error %v, expected one that may have succeeded", name, err)
+		}
+		if sends != 1 || r.Attempts != 1 {
+			t.Errorf("%s: sent %d times in %d attempts, expected once", name, sends, r.Attempts)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// rpcCommand starts a request/response loop over stdin and stdout instead of running one command.
+const rpcCommand = "rpc"
+
+// Requests accepted but not yet started. The reader blocks when the queue is full.
+const rpcQueueSize = 64
+
+// Longest request line accepted by the rpc loop.
+const rpcMaxLine = 1 << 20
+
+var ErrInvalidRequest = errors.New("invalid request")
+
+// rpcRequest is one line of input in rpc mode. Either Command or Cancel is set; Cancel holds the id
+// of an earlier request to abandon.
+type rpcRequest struct {
+	ID      json.RawMessage   `json:"id"`
+	Command string            `json:"command"`
+	Args    map[string]string `json:"args"`
+	Cancel  json.RawMessage   `json:"cancel"`
+}
+
+// rpcResponse is the command's Result tagged with the id of the request it answers.
+type rpcResponse struct {
+	ID json.RawMessage `json:"id"`
+	*Result
+}
+
+// rpcCall is a request waiting for, or undergoing, execution.
+type rpcCall struct {
+	id     json.RawMessage
+	args   []string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// rpcServer runs requests one at a time, in the order received, over a single vehicle session.
+// Cancellations are handled as soon as they are read.
+type rpcServer struct {
+	ctx     context.Context // cancelling it cancels every request
+	session *session
+	timeout time.Duration
+
+	writeLock sync.Mutex
+	out       io.Writer
+
+	lock    sync.Mutex
+	pending map[string]*rpcCall // queued and running requests, by id
+}
+
+// runRPC serves newline-delimited JSON requests from in until end of input, an exit request or
+// the cancellation of ctx, writing one JSON response per request to out. Responses to commands
+// arrive in request order; responses to cancellations may overtake them.
+func runRPC(ctx context.Context, sess *session, in io.Reader, out io.Writer, timeout time.Duration) int {
+	s := &rpcServer{ctx: ctx, session: sess, timeout: timeout, out: out, pending: make(map[string]*rpcCall)}
+
+	queue := make(chan *rpcCall, rpcQueueSize)
+	done := make(chan struct{})
+	go func() {
+		for call := range queue {
+			s.call(call)
+		}
+		close(done)
+	}()
+
+	// Reading happens in the background so that cancelling ctx ends the loop even while it waits
+	// for input.
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 4096), rpcMaxLine)
+		for scanner.Scan() {
+			select {
+			case lines <- bytes.Clone(scanner.Bytes()):
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		var line []byte
+		more := false
+		select {
+		case <-ctx.Done():
+		case line, more = <-lines:
+		}
+		if !more {
+			break
+		}
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.fail(nil, "", fmt.Errorf("%w: %s", ErrInvalidRequest, err))
+			continue
+		}
+		if req.Cancel != nil {
+			s.cancelRequest(req.ID, req.Cancel)
+			continue
+		}
+		if req.Command == "exit" {
+			break
+		}
+		call, err := s.accept(req)
+		if err != nil {
+			s.fail(req.ID, req.Command, err)
+			continue
+		}
+		queue <- call
+	}
+	close(queue)
+	<-done
+
+	if err := ctx.Err(); err != nil {
+		return classify(err).exit
+	}
+	select {
+	case err := <-readErr:
+		if err != nil {
+			log.Printf("Error reading requests: %s", err)
+			return 1
+		}
+	default:
+	}
+	return 0
+}
+
+// idKey returns a canonical form of a request id for use as a map key.
+func idKey(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+// accept validates req and registers it so that it can be cancelled while queued.
+func (s *rpcServer) accept(req rpcRequest) (*rpcCall, error) {
+	if req.ID == nil {
+		return nil, fmt.Errorf("%w: missing id", ErrInvalidRequest)
+	}
+	// help writes straight to stdout, which would corrupt the response stream
+	if req.Command == "help" {
+		return nil, fmt.Errorf("%w: help is not available in rpc mode, use commands --json", ErrInvalidRequest)
+	}
+	info, ok := commands[req.Command]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCommand, req.Command)
+	}
+	values, err := info.positional(req.Args)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := info.parseArgs(values); err != nil {
+		return nil, err
+	}
+
+	call := &rpcCall{id: req.ID, args: append([]string{req.Command}, values...)}
+	call.ctx, call.cancel = context.WithCancel(s.ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := idKey(req.ID)
+	if _, ok := s.pending[key]; ok {
+		call.cancel()
+		return nil, fmt.Errorf("%w: request %s is already pending", ErrInvalidRequest, key)
+	}
+	s.pending[key] = call
+	return call, nil
+}
+
+// call executes a queued request, unless it was cancelled before its turn.
+func (s *rpcServer) call(call *rpcCall) {
+	defer func() {
+		s.lock.Lock()
+		delete(s.pending, idKey(call.id))
+		s.lock.Unlock()
+		call.cancel()
+	}()
+
+	r := newResult(call.args[0])
+	if err := call.ctx.Err(); err != nil {
+		r.finish(err)
+	} else {
+		r.run(call.ctx, s.session, call.args, s.timeout)
+	}
+	s.reply(call.id, r)
+}
+
+// cancelRequest cancels the pending request target and acknowledges with the id of the
+// cancellation itself. The cancelled request still receives its own response.
+func (s *rpcServer) cancelRequest(id, target json.RawMessage) {
+	s.lock.Lock()
+	call, ok := s.pending[idKey(target)]
+	s.lock.Unlock()
+
+	r := newResult("cancel")
+	if !ok {
+		r.finish(fmt.Errorf("%w: no pending request %s", ErrInvalidRequest, idKey(target)))
+	} else {
+		call.cancel()
+		r.finish(nil)
+	}
+	s.reply(id, r)
+}
+
+func (s *rpcServer) fail(id json.RawMessage, command string, err error) {
+	r := newResult(command)
+	r.finish(err)
+	s.reply(id, r)
+}
+
+func (s *rpcServer) reply(id json.RawMessage, r *Result) {
+	data, err := json.Marshal(rpcResponse{ID: id, Result: r})
+	if err != nil {
+		log.Printf("Error encoding response: %s", err)
+		return
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	fmt.Fprintln(s.out, string(data))
+}
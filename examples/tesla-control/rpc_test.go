@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRPC(t *testing.T) {
+	requests := strings.Join([]string{
+		`{"id":1,"command":"commands"}`,
+		`{"id":"two","command":"fly-to-moon"}`,
+		`{"id":3,"command":"charging-set-limit","args":{"PERCENT":"20"}}`,
+		`{"id":4,"command":"charging-set-limit","args":{"LIMIT":"80"}}`,
+		`{"id":5,"cancel":99}`,
+		`not json`,
+		`{"id":6,"command":"completion","args":{"SHELL":"bash"}}`,
+		`{"id":7,"command":"help"}`,
+		`{"id":8,"command":"help","args":{"COMMAND":"honk"}}`,
+		`{"command":"exit"}`,
+		`{"id":9,"command":"commands"}`,
+	}, "\n")
+
+	// Responses go to stdout as in rpc mode, so that anything else printed there corrupts the
+	// stream and fails the test.
+	out, err := os.CreateTemp(t.TempDir(), "rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	status := runRPC(context.Background(), nil, strings.NewReader(requests), out, 5*time.Second)
+	os.Stdout = stdout
+	if status != 0 {
+		t.Fatalf("unexpected exit status %d", status)
+	}
+	stream, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	classes := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(stream)), "\n") {
+		var response struct {
+			ID         json.RawMessage `json:"id"`
+			Success    bool            `json:"success"`
+			ErrorClass string          `json:"error_class"`
+		}
+		if err := json.Unmarshal([]byte(line), &response); err != nil {
+			t.Fatalf("invalid response %s: %s", line, err)
+		}
+		class := response.ErrorClass
+		if response.Success {
+			class = "ok"
+		}
+		classes[string(response.ID)] = class
+	}
+
+	expected := map[string]string{
+		`1`:     "ok",
+		`"two"`: "unknown_command",
+		`3`:     "invalid_arguments",
+		`4`:     "invalid_arguments",
+		`5`:     "invalid_request",
+		`null`:  "invalid_request",
+		`6`:     "ok",
+		`7`:     "invalid_request",
+		`8`:     "invalid_request",
+	}
+	if len(classes) != len(expected) {
+		t.Errorf("got responses %v, expected %v", classes, expected)
+	}
+	for id, class := range expected {
+		if classes[id] != class {
+			t.Errorf("request %s: got %q, expected %q", id, classes[id], class)
+		}
+	}
+}
+
+func TestPositional(t *testing.T) {
+	info := commands["commands"]
+	if values, err := info.positional(map[string]string{}); err != nil || len(values) != 0 {
+		t.Errorf("got %v, %v for no arguments", values, err)
+	}
+	if values, err := info.positional(map[string]string{"FORMAT": "--json"}); err != nil || len(values) != 1 || values[0] != "--json" {
+		t.Errorf("got %v, %v for FORMAT", values, err)
+	}
+	if _, err := info.positional(map[string]string{"COLOR": "red"}); err == nil {
+		t.Error("expected an error for an unknown argument")
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Script directives. They are handled by the script runner rather than the commands map.
+const (
+	directiveSleep   = "sleep"    // sleep DURATION
+	directiveOnError = "on-error" // on-error continue|stop
+	directiveExit    = "exit"     // stop processing the script
+)
+
+// Error policies selected with the on-error directive.
+const (
+	onErrorStop     = "stop"
+	onErrorContinue = "continue"
+)
+
+// Line statuses in the script summary.
+const (
+	lineOK      = "ok"
+	lineFailed  = "failed"
+	lineSkipped = "skipped"
+)
+
+// scriptLine is a command or directive read from a script.
+type scriptLine struct {
+	number int
+	args   []string // command or directive followed by its arguments, after substitution
+}
+
+// lineSummary reports the outcome of one script line.
+type lineSummary struct {
+	Line       int    `json:"line"`
+	Command    string `json:"command"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// scriptSummary is the response of the final "script" result.
+type scriptSummary struct {
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Skipped   int           `json:"skipped"`
+	Lines     []lineSummary `json:"lines"`
+}
+
+// openScript returns the script named by -f, where "-" is standard input.
+func openScript(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+// stdinIsPipe is true when standard input is redirected from a file or pipe.
+func stdinIsPipe() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// wordPart is a run of characters within a word. Literal parts come from single quotes or
+// backslash escapes and are never expanded.
+type wordPart struct {
+	text    string
+	literal bool
+}
+
+// splitWords splits a line into words. Single or double quotes group words containing spaces, and
+// an unquoted # at the start of a word begins a comment. Variables are expanded only after the
+// line is split, so that a value containing spaces or # stays a single word.
+func splitWords(line string) ([][]wordPart, error) {
+	var (
+		words   [][]wordPart
+		word    []wordPart
+		part    strings.Builder
+		literal bool
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	add := func(c rune, lit bool) {
+		if part.Len() > 0 && lit != literal {
+			word = append(word, wordPart{text: part.String(), literal: literal})
+			part.Reset()
+		}
+		part.WriteRune(c)
+		literal, inWord = lit, true
+	}
+	endWord := func() {
+		if part.Len() > 0 {
+			word = append(word, wordPart{text: part.String(), literal: literal})
+			part.Reset()
+		}
+		words = append(words, word)
+		word, inWord = nil, false
+	}
+scan:
+	for _, c := range line {
+		switch {
+		case c == '#' && !inWord && quote == 0:
+			break scan
+		case escaped:
+			add(c, true)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				add(c, quote == '\'')
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t':
+			if inWord {
+				endWord()
+			}
+		default:
+			add(c, false)
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		endWord()
+	}
+	return words, nil
+}
+
+// expandVars substitutes $NAME and ${NAME} from the environment in each word, leaving single-quoted
+// and escaped text alone. Unset variables are an error so that a typo cannot silently send an
+// empty argument.
+func expandVars(words [][]wordPart, lookup func(string) (string, bool)) ([]string, error) {
+	var missing []string
+	mapping := func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		value, ok := lookup(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	}
+	args := make([]string, 0, len(words))
+	for _, word := range words {
+		var arg strings.Builder
+		for _, part := range word {
+			if part.literal {
+				arg.WriteString(part.text)
+			} else {
+				arg.WriteString(os.Expand(part.text, mapping))
+			}
+		}
+		args = append(args, arg.String())
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined variable %s", strings.Join(missing, ", "))
+	}
+	return args, nil
+}
+
+// checkLine validates a command or directive without using the network.
+func checkLine(args []string) error {
+	switch args[0] {
+	case directiveSleep:
+		if len(args) != 2 {
+			return fmt.Errorf("%w: usage: sleep DURATION", ErrCommandLineArgs)
+		}
+		if d, err := time.ParseDuration(args[1]); err != nil || d < 0 {
+			return fmt.Errorf("%w: invalid DURATION '%s'", ErrCommandLineArgs, args[1])
+		}
+		return nil
+	case directiveOnError:
+		if len(args) != 2 || (args[1] != onErrorContinue && args[1] != onErrorStop) {
+			return fmt.Errorf("%w: usage: on-error continue|stop", ErrCommandLineArgs)
+		}
+		return nil
+	case directiveExit:
+		if len(args) != 1 {
+			return fmt.Errorf("%w: usage: exit", ErrCommandLineArgs)
+		}
+		return nil
+	case "help":
+		return nil
+	}
+	info, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, args[0])
+	}
+	_, err := info.parseArgs(args[1:])
+	return err
+}
+
+// parseScript reads a script and validates every line, so that mistakes are reported before
+// anything is sent to the vehicle. Blank lines and lines starting with # are ignored. All errors
+// are returned together, each prefixed with its line number.
+func parseScript(r io.Reader, lookup func(string) (string, bool)) ([]scriptLine, error) {
+	var (
+		lines []scriptLine
+		errs  []error
+	)
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		words, err := splitWords(text)
+		if err == nil {
+			var args []string
+			if args, err = expandVars(words, lookup); err == nil {
+				if err = checkLine(args); err == nil {
+					lines = append(lines, scriptLine{number: number, args: args})
+				}
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", number, err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return lines, errors.Join(errs...)
+}
+
+// runScript executes lines in order over one session and responds with a per-line summary. It
+// returns zero if every command succeeded and otherwise the exit status of the failures. Lines
+// after ctx is cancelled are skipped, and the cancellation counts as a failure.
+func runScript(ctx context.Context, s *session, lines []scriptLine, timeout time.Duration) int {
+	result := newResult("script")
+	summary := scriptSummary{Lines: []lineSummary{}}
+	var failures []error
+	onError := onErrorStop
+	stopped := false
+	for _, line := range lines {
+		name := line.args[0]
+		if stopped || ctx.Err() != nil {
+			if name != directiveSleep && name != directiveOnError && name != directiveExit {
+				summary.Lines = append(summary.Lines, lineSummary{Line: line.number, Command: name, Status: lineSkipped})
+				summary.Skipped++
+			}
+			continue
+		}
+
+		switch name {
+		case directiveSleep:
+			d, _ := time.ParseDuration(line.args[1])
+			select {
+			case <-ctx.Done():
+			case <-time.After(d):
+			}
+			continue
+		case directiveOnError:
+			onError = line.args[1]
+			continue
+		case directiveExit:
+			stopped = true
+			continue
+		}
+
+		r := newResult(name)
+		r.Line = line.number
+		r.run(ctx, s, line.args, timeout)
+		writeResult(os.Stdout, r)
+
+		entry := lineSummary{Line: line.number, Command: name, Status: lineOK, DurationMs: r.DurationMs}
+		if r.err != nil {
+			entry.Status, entry.ErrorClass, entry.Error = lineFailed, r.ErrorClass, r.Error
+			summary.Failed++
+			failures = append(failures, r.err)
+			if outputMode == outputText {
+				writeErr("line %d: %s (%s): %s", line.number, name, r.ErrorClass, r.err)
+			}
+			stopped = onError == onErrorStop
+		} else {
+			summary.Succeeded++
+		}
+		summary.Lines = append(summary.Lines, entry)
+	}
+
+	var err error
+	switch {
+	case ctx.Err() != nil:
+		// an interrupted script fails even if every command it got to succeeded
+		err = fmt.Errorf("script interrupted: %w", ctx.Err())
+		failures = append(failures, ctx.Err())
+	case summary.Failed > 0:
+		err = fmt.Errorf("%d of %d commands failed", summary.Failed, len(summary.Lines))
+	}
+	respond(withResult(context.Background(), result), summary, summary.text())
+	result.finish(err)
+	writeResult(os.Stdout, result)
+	return exitStatus(failures)
+}
+
+func (s *scriptSummary) text() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tCOMMAND\tSTATUS\tDURATION\tERROR")
+	for _, line := range s.Lines {
+		duration := "-"
+		if line.Status != lineSkipped {
+			duration = (time.Duration(line.DurationMs) * time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", line.Line, line.Command, line.Status, duration, line.Error)
+	}
+	w.Flush()
+	fmt.Fprintf(&buf, "%d succeeded, %d failed, %d skipped", s.Succeeded, s.Failed, s.Skipped)
+	return buf.String()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScript(t *testing.T) {
+	env := map[string]string{"LIMIT": "80", "CATEGORY": "tire-pressure"}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	script := `
+# morning routine
+on-error continue
+charging-set-limit $LIMIT
+sleep 2s
+climate-set-temp 21C
+state "${CATEGORY}" # check the tires
+`
+	lines, err := parseScript(strings.NewReader(script), lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []scriptLine{
+		{number: 3, args: []string{"on-error", "continue"}},
+		{number: 4, args: []string{"charging-set-limit", "80"}},
+		{number: 5, args: []string{"sleep", "2s"}},
+		{number: 6, args: []string{"climate-set-temp", "21C"}},
+		{number: 7, args: []string{"state", "tire-pressure"}},
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("got %v, expected %v", lines, expected)
+	}
+
+	bad := "lock\nfly-to-moon\ncharging-set-limit 120\nsleep soon\non-error maybe\nwake $UNSET\nhonk 'horn\n"
+	_, err = parseScript(strings.NewReader(bad), lookup)
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, line := range []string{"line 2:", "line 3:", "line 4:", "line 5:", "line 6:", "line 7:"} {
+		if !strings.Contains(err.Error(), line) {
+			t.Errorf("expected an error for %s got %s", line, err)
+		}
+	}
+	if strings.Contains(err.Error(), "line 1:") {
+		t.Errorf("unexpected error for line 1: %s", err)
+	}
+	if !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("expected ErrUnknownCommand in %s", err)
+	}
+}
+
+func TestParseScriptExpansion(t *testing.T) {
+	env := map[string]string{"CAR": "Blue Car", "NAME": "car #2", "HOME": "/home/tesla"}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	script := `
+vehicles use $CAR
+vehicles use "$CAR"
+vehicles alias $NAME $CAR
+vehicles alias '$NAME' $CAR
+vehicles alias \$HOME"/$NAME" $CAR
+vehicles alias $HOME/car ${NAME}x # $UNSET is only mentioned in a comment
+`
+	lines, err := parseScript(strings.NewReader(script), lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []scriptLine{
+		{number: 2, args: []string{"vehicles", "use", "Blue Car"}},
+		{number: 3, args: []string{"vehicles", "use", "Blue Car"}},
+		{number: 4, args: []string{"vehicles", "alias", "car #2", "Blue Car"}},
+		{number: 5, args: []string{"vehicles", "alias", "$NAME", "Blue Car"}},
+		{number: 6, args: []string{"vehicles", "alias", "$HOME/car #2", "Blue Car"}},
+		{number: 7, args: []string{"vehicles", "alias", "/home/tesla/car", "car #2x"}},
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("got %q, expected %q", lines, expected)
+	}
+}
+
+func TestRunScriptCancelled(t *testing.T) {
+	lines, err := parseScript(strings.NewReader("commands\nsleep 1m\ncommands\n"), func(string) (string, bool) { return "", false })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// cancel during the sleep, as Ctrl-C or SIGTERM would
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	status := runScript(ctx, nil, lines, time.Second)
+	if waited := time.Since(start); waited > 10*time.Second {
+		t.Errorf("script took %s after cancellation", waited)
+	}
+	if expected := classify(context.Canceled).exit; status != expected {
+		t.Errorf("got exit status %d, expected %d", status, expected)
+	}
+}
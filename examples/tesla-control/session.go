@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/inindev/tesla_utils/auth"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// Reuse vehicle sessions saved by earlier runs, set with -session-cache.
+var useSessionCache = true
+
+// session holds the account and vehicle connection shared by the commands of one invocation.
+// Nothing is set up in advance: each command sets up only what it needs, the first time it is
+// needed, so account-only commands never wake the vehicle. A nil session sets up nothing, which
+// is what dry runs use.
+type session struct {
+	vin         string // empty if no vehicle is selected
+	connTimeout time.Duration
+
+	acct       *account.Account
+	privateKey protocol.ECDHPrivateKey
+	keyErr     error // why privateKey could not be loaded
+	keyLoaded  bool
+	car        *vehicle.Vehicle
+	awake      bool
+	domains    map[protocol.Domain]bool // domains with an authenticated session
+	cached     bool                     // sessions are saved to the profile's session cache on close
+}
+
+func newSession(vin string, connTimeout time.Duration) *session {
+	return &session{vin: vin, connTimeout: connTimeout}
+}
+
+// requirements returns what commandName needs as a cli.Config. Its flags are FlagOAuth for an
+// account, FlagVIN for a vehicle connection and FlagPrivateKey for an authenticated session, and
+// Domains lists the domain the command is sent to. Missing credentials are reported without using
+// the network.
+func (s *session) requirements(commandName string) (cli.Config, error) {
+	c := cli.Config{VIN: s.vin}
+	havePrivateKey, haveOAuth := haveCredentials()
+	if havePrivateKey {
+		c.KeyFilename, _ = auth.GetKeyFile()
+	}
+	if haveOAuth {
+		c.TokenFilename = auth.AuthCacheFilePath()
+	}
+	// this tool always reaches the vehicle through the Fleet API
+	err := configureFlags(&c, commandName, false)
+	return c, err
+}
+
+// check reports whether commandName can run with the available credentials. Local and unknown
+// commands always pass; execute deals with them.
+func (s *session) check(commandName string) error {
+	if info, ok := commands[commandName]; !ok || info.local || s == nil {
+		return nil
+	}
+	_, err := s.requirements(commandName)
+	return err
+}
+
+// setupPlan lists the parts of a session that a command needs.
+type setupPlan struct {
+	account bool // Fleet API account
+	vehicle bool // vehicle connection, which does not by itself wake the vehicle
+	wake    bool
+	secure  bool            // authenticated session, which needs the private key
+	domain  protocol.Domain // domain to start the session with; DomainNone means all of them
+}
+
+// planSetup derives a setupPlan from the cli.Config returned by requirements. Fleet API endpoints
+// under /vehicles/{vin} need the VIN, but not a vehicle that is awake. The wake command wakes the
+// vehicle itself. With -verify, commands that are read back also need an infotainment session,
+// since vehicle state is read through infotainment whatever the command's own domain.
+func planSetup(commandName string, c cli.Config, haveVIN bool) setupPlan {
+	info := commands[commandName]
+	flags := c.Flags
+	talksToVehicle := flags&cli.FlagVIN != 0
+	plan := setupPlan{account: flags&cli.FlagOAuth != 0}
+	if haveVIN && (talksToVehicle || strings.Contains(info.endpoint, "{vin}")) {
+		plan.vehicle = true
+		plan.wake = talksToVehicle && commandName != "wake"
+		plan.secure = flags&cli.FlagPrivateKey != 0
+		if plan.secure && len(c.Domains) == 1 {
+			plan.domain = c.Domains[0]
+		}
+		if _, ok := verifiers[commandName]; ok && verifyMode && plan.domain != protocol.DomainInfotainment {
+			plan.domain = protocol.DomainNone
+		}
+	}
+	return plan
+}
+
+// prepare sets up what commandName needs and returns the account and vehicle to run it with.
+// Setup is bounded by the connection timeout rather than the command timeout, extended by the
+// wake policy's maximum wait if the vehicle may need waking.
+func (s *session) prepare(ctx context.Context, commandName string) (*account.Account, *vehicle.Vehicle, error) {
+	info, ok := commands[commandName]
+	if s == nil || !ok || info.local {
+		return nil, nil, nil
+	}
+	c, err := s.requirements(commandName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan := planSetup(commandName, c, s.vin != "")
+
+	timeout := s.connTimeout
+	if plan.wake && !s.awake {
+		timeout += wakePolicy.MaxWait
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if plan.account {
+		if err := s.loadAccount(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if !plan.vehicle {
+		return s.acct, nil, nil
+	}
+	if err := s.connect(ctx, plan.secure); err != nil {
+		return nil, nil, err
+	}
+	if plan.wake {
+		if err := s.wake(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	if plan.secure {
+		if err := s.startSession(ctx, plan.domain); err != nil {
+			return nil, nil, err
+		}
+	}
+	return s.acct, s.car, nil
+}
+
+func (s *session) loadAccount() error {
+	if s.acct != nil {
+		return nil
+	}
+	authData, err := loadAuthData()
+	if err != nil {
+		return fmt.Errorf("Error loading credentials: %w", err)
+	}
+	if s.acct, err = account.New(authData.AccessToken, ""); err != nil {
+		return fmt.Errorf("Error creating account: %w", err)
+	}
+	return nil
+}
+
+// loadPrivateKey reads the private key once. A missing key only matters to commands that need an
+// authenticated session.
+func (s *session) loadPrivateKey() error {
+	if !s.keyLoaded {
+		s.keyLoaded = true
+		keyFile, err := auth.GetKeyFile()
+		if err != nil {
+			s.keyErr = fmt.Errorf("Error getting key file path: %w", err)
+		} else if s.privateKey, err = protocol.LoadPrivateKey(keyFile); err != nil {
+			s.keyErr = fmt.Errorf("Error loading private key: %w", err)
+		}
+	}
+	return s.keyErr
+}
+
+// connect creates the vehicle connection. The private key is loaded if available so that the
+// same connection serves later commands that need it.
+func (s *session) connect(ctx context.Context, needKey bool) error {
+	if err := s.loadPrivateKey(); err != nil && needKey {
+		return err
+	}
+	if s.car != nil {
+		return nil
+	}
+	if err := s.loadAccount(); err != nil {
+		return err
+	}
+	// Sessions loaded from the cache skip the handshake in startSession. If the vehicle rejects one,
+	// vehicle-command resynchronizes with the vehicle and retries the command.
+	var sessions *cache.SessionCache
+	if useSessionCache && s.privateKey != nil {
+		sessions = auth.LoadSessionCache()
+		s.cached = true
+	}
+	car, err := s.acct.GetVehicle(ctx, s.vin, s.privateKey, sessions)
+	if err != nil {
+		return fmt.Errorf("Error: GetVehicle failed: %w", err)
+	}
+	if err := car.Connect(ctx); err != nil {
+		return fmt.Errorf("Error: Connect failed: %w", err)
+	}
+	s.car = car
+	return nil
+}
+
+// wake waits for the vehicle to come online according to wakePolicy, waking it if allowed.
+func (s *session) wake(ctx context.Context) error {
+	if s.awake {
+		return nil
+	}
+	state := func(ctx context.Context) (string, error) { return vehicleState(ctx, s.acct, s.vin) }
+	progress := func(state string, waited time.Duration) {
+		log.Printf("%s: Waiting for vehicle to come online: %s after %s", s.vin, state, waited.Round(time.Second))
+	}
+	if err := waitOnline(ctx, wakePolicy, state, s.car.Wakeup, progress); err != nil {
+		return err
+	}
+	s.awake = true
+	return nil
+}
+
+// startSession handshakes with domain, or with every domain if domain is DomainNone, skipping
+// domains that already have a session. Commands sent to another domain later in the same
+// invocation, such as in the interactive shell, add their domain on demand.
+func (s *session) startSession(ctx context.Context, domain protocol.Domain) error {
+	wanted := []protocol.Domain{domain}
+	if domain == protocol.DomainNone {
+		wanted = []protocol.Domain{protocol.DomainVCSEC, protocol.DomainInfotainment}
+	}
+	var missing []protocol.Domain
+	for _, d := range wanted {
+		if !s.domains[d] {
+			missing = append(missing, d)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	backoff := time.Second
+	for attempt := 0; attempt < 5; attempt++ {
+		if ctx.Err() != nil {
+			return fmt.Errorf("Context timed out or canceled during StartSession retries: %w", ctx.Err())
+		}
+		if err := s.car.StartSession(ctx, missing); err == nil {
+			log.Printf("%s: StartSession %v succeeded on attempt %d", s.vin, missing, attempt+1)
+			break
+		} else {
+			log.Printf("%s: Error: StartSession failed on attempt %d: %v", s.vin, attempt+1, err)
+			if attempt == 4 {
+				return fmt.Errorf("Error: Failed to start session after multiple attempts: %w", err)
+			}
+			time.Sleep(backoff)
+			backoff *= 2 // double the wait time for each retry
+		}
+	}
+	if s.domains == nil {
+		s.domains = make(map[protocol.Domain]bool)
+	}
+	for _, d := range missing {
+		s.domains[d] = true
+	}
+	return nil
+}
+
+// account returns the account, loading credentials if needed. It is used to list the vehicles on
+// the account before any command runs.
+func (s *session) account() (*account.Account, error) {
+	if err := s.loadAccount(); err != nil {
+		return nil, err
+	}
+	return s.acct, nil
+}
+
+// close saves the vehicle's sessions for later runs and disconnects.
+func (s *session) close() {
+	if s != nil && s.car != nil {
+		if s.cached && len(s.domains) > 0 {
+			if err := auth.SaveSessionCache(s.car); err != nil {
+				log.Printf("%s: Error saving session cache: %s", s.vin, err)
+			}
+		}
+		s.car.Disconnect()
+		s.car = nil
+		s.domains = nil
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+func TestPlanSetup(t *testing.T) {
+	testCases := []struct {
+		command  string
+		haveVIN  bool
+		expected setupPlan
+	}{
+		{command: "lock", haveVIN: true, expected: setupPlan{account: true, vehicle: true, wake: true, secure: true, domain: protocol.DomainVCSEC}},
+		{command: "honk", haveVIN: true, expected: setupPlan{account: true, vehicle: true, wake: true, secure: true, domain: protocol.DomainInfotainment}},
+		{command: "wake", haveVIN: true, expected: setupPlan{account: true, vehicle: true}},
+		{command: "get-vehicle-data", haveVIN: true, expected: setupPlan{account: true, vehicle: true}},
+		{command: "vehicles", haveVIN: true, expected: setupPlan{account: true}},
+		{command: "add-key-request", haveVIN: true, expected: setupPlan{account: true, vehicle: true, wake: true}},
+	}
+	for _, test := range testCases {
+		c := cli.Config{KeyFilename: "private.key", TokenFilename: "token.json"}
+		if test.haveVIN {
+			c.VIN = "5YJ3E1EA7KF123456"
+		}
+		if err := configureFlags(&c, test.command, false); err != nil {
+			t.Errorf("%s: unexpected error: %s", test.command, err)
+			continue
+		}
+		if plan := planSetup(test.command, c, test.haveVIN); plan != test.expected {
+			t.Errorf("%s: got %+v, expected %+v", test.command, plan, test.expected)
+		}
+	}
+}
+
+// Fleet API commands under /vehicles/{vin} fail before setup without a VIN, rather than running
+// without a vehicle.
+func TestRequirementsVIN(t *testing.T) {
+	testCases := []struct {
+		command string
+		err     error
+	}{
+		{command: "get-vehicle-data", err: ErrRequiresVIN},
+		{command: "get-options", err: ErrRequiresVIN},
+		{command: "honk", err: ErrRequiresVIN},
+		{command: "vehicles", err: nil},
+		{command: "product-info", err: nil},
+	}
+	for _, test := range testCases {
+		c := cli.Config{KeyFilename: "private.key", TokenFilename: "token.json"}
+		err := configureFlags(&c, test.command, false)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, expected %v", test.command, err, test.err)
+		}
+		if test.err != nil {
+			if class := classify(err); class.name != "vin_required" || class.exit != 17 {
+				t.Errorf("%s: got class %s (exit status %d), expected vin_required (17)", test.command, class.name, class.exit)
+			}
+		}
+	}
+}
+
+// With -verify, every command that is read back must have an infotainment session, which
+// car.GetState needs.
+func TestPlanSetupVerify(t *testing.T) {
+	defer func(mode bool) { verifyMode = mode }(verifyMode)
+	for _, mode := range []bool{false, true} {
+		verifyMode = mode
+		for name := range verifiers {
+			c := cli.Config{VIN: "5YJ3E1EA7KF123456", KeyFilename: "private.key", TokenFilename: "token.json"}
+			if err := configureFlags(&c, name, false); err != nil {
+				t.Errorf("%s: unexpected error: %s", name, err)
+				continue
+			}
+			plan := planSetup(name, c, true)
+			readBack := plan.domain == protocol.DomainInfotainment || plan.domain == protocol.DomainNone
+			if mode && !readBack {
+				t.Errorf("%s with -verify: no infotainment session for the read-back (domain %s)", name, plan.domain)
+			}
+			if !mode && plan.domain != commands[name].domain {
+				t.Errorf("%s: got domain %s, expected %s", name, plan.domain, commands[name].domain)
+			}
+		}
+	}
+}
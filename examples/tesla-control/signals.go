@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// signalContext returns a context derived from parent that is cancelled when one of signals
+// arrives. Only the first signal is caught, so a second one, such as another Ctrl-C while a
+// cancelled command winds down, has its default effect. stop releases the signals and must be
+// called once the context is no longer needed.
+func signalContext(parent context.Context, signals ...os.Signal) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	caught := make(chan os.Signal, 1)
+	signal.Notify(caught, signals...)
+	go func() {
+		select {
+		case sig := <-caught:
+			signal.Stop(caught)
+			log.Printf("Received %s, cancelling", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(caught)
+		cancel()
+	}
+}
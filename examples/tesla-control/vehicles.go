@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/inindev/tesla_utils/auth"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+)
+
+// Actions of the vehicles command.
+const (
+	vehiclesList    = "list"
+	vehiclesUse     = "use"
+	vehiclesAlias   = "alias"
+	vehiclesUnalias = "unalias"
+)
+
+// vehicleSummary is one entry of the vehicles listing.
+type vehicleSummary struct {
+	VIN         string   `json:"vin"`
+	DisplayName string   `json:"display_name"`
+	Model       string   `json:"model"`
+	State       string   `json:"state"` // online, asleep or offline
+	Aliases     []string `json:"aliases,omitempty"`
+	Default     bool     `json:"default"`
+}
+
+// fetchVehicles lists the vehicles on the account.
+func fetchVehicles(ctx context.Context, acct *account.Account) ([]vehicleSummary, error) {
+	reply, err := acct.Get(ctx, "api/1/vehicles")
+	if err != nil {
+		return nil, err
+	}
+	var vehicles struct {
+		Response []struct {
+			VIN         string `json:"vin"`
+			DisplayName string `json:"display_name"`
+			State       string `json:"state"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(reply, &vehicles); err != nil {
+		return nil, fmt.Errorf("failed to parse vehicle list: %w", err)
+	}
+	summaries := make([]vehicleSummary, 0, len(vehicles.Response))
+	for _, v := range vehicles.Response {
+		summaries = append(summaries, vehicleSummary{
+			VIN:         v.VIN,
+			DisplayName: v.DisplayName,
+			Model:       modelName(v.VIN),
+			State:       v.State,
+		})
+	}
+	return summaries, nil
+}
+
+// listAccountVINs returns the VINs of the vehicles on the account.
+func listAccountVINs(ctx context.Context, acct *account.Account) ([]string, error) {
+	vehicles, err := fetchVehicles(ctx, acct)
+	if err != nil {
+		return nil, err
+	}
+	vins := make([]string, 0, len(vehicles))
+	for _, v := range vehicles {
+		vins = append(vins, v.VIN)
+	}
+	return vins, nil
+}
+
+// modelName decodes the model from the fourth character of a Tesla VIN.
+func modelName(vin string) string {
+	if len(vin) < 4 {
+		return "unknown"
+	}
+	switch vin[3] {
+	case 'S':
+		return "Model S"
+	case '3':
+		return "Model 3"
+	case 'X':
+		return "Model X"
+	case 'Y':
+		return "Model Y"
+	case 'C':
+		return "Cybertruck"
+	case 'R':
+		return "Roadster"
+	case 'T':
+		return "Semi"
+	}
+	return "unknown"
+}
+
+// resolveVehicle returns the VIN that name refers to: an alias, a VIN, or the display name of a
+// vehicle on the account. vehicles is only called when name is neither an alias nor a VIN.
+func resolveVehicle(name string, aliases map[string]string, vehicles func() ([]vehicleSummary, error)) (string, error) {
+	if vin, ok := aliases[name]; ok {
+		return strings.ToUpper(vin), nil
+	}
+	if auth.ValidateVin(strings.ToUpper(name)) == nil {
+		return strings.ToUpper(name), nil
+	}
+	list, err := vehicles()
+	if err != nil {
+		return "", err
+	}
+	var matches []string
+	for _, v := range list {
+		if strings.EqualFold(v.DisplayName, name) {
+			matches = append(matches, v.VIN)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: no vehicle named '%s'", ErrCommandLineArgs, name)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("%w: %d vehicles are named '%s', use the VIN", ErrCommandLineArgs, len(matches), name)
+}
+
+// manageVehicles implements the vehicles command.
+func manageVehicles(ctx context.Context, acct *account.Account, args map[string]string) error {
+	action, name, target := args["ACTION"], args["NAME"], args["VIN"]
+	if action == "" {
+		action = vehiclesList
+	}
+	switch {
+	case action == vehiclesList && name != "":
+		return fmt.Errorf("%w: list takes no NAME", ErrCommandLineArgs)
+	case action != vehiclesList && name == "":
+		return fmt.Errorf("%w: %s requires NAME", ErrCommandLineArgs, action)
+	case action == vehiclesAlias && target == "":
+		return fmt.Errorf("%w: alias requires NAME and VIN", ErrCommandLineArgs)
+	case action != vehiclesAlias && target != "":
+		return fmt.Errorf("%w: %s takes no VIN", ErrCommandLineArgs, action)
+	}
+
+	aliases, err := auth.GetAliases()
+	if err != nil {
+		return err
+	}
+	vehicles := func() ([]vehicleSummary, error) { return fetchVehicles(ctx, acct) }
+
+	switch action {
+	case vehiclesUse:
+		vin, err := resolveVehicle(name, aliases, vehicles)
+		if err != nil {
+			return err
+		}
+		if dryRunMode {
+			return errDryRun
+		}
+		if err := auth.SetVin(vin); err != nil {
+			return err
+		}
+		respond(ctx, map[string]string{"vin": vin}, fmt.Sprintf("Default vehicle set to %s", vin))
+		return nil
+	case vehiclesAlias:
+		if err := auth.ValidateAlias(name); err != nil {
+			return fmt.Errorf("%w: %s", ErrCommandLineArgs, err)
+		}
+		vin, err := resolveVehicle(target, aliases, vehicles)
+		if err != nil {
+			return err
+		}
+		if dryRunMode {
+			return errDryRun
+		}
+		if err := auth.SetAlias(name, vin); err != nil {
+			return err
+		}
+		respond(ctx, map[string]string{"alias": name, "vin": vin}, fmt.Sprintf("%s is now an alias for %s", name, vin))
+		return nil
+	case vehiclesUnalias:
+		if _, ok := aliases[name]; !ok {
+			return fmt.Errorf("%w: no alias '%s'", ErrCommandLineArgs, name)
+		}
+		if dryRunMode {
+			return errDryRun
+		}
+		if err := auth.SetAlias(name, ""); err != nil {
+			return err
+		}
+		respond(ctx, map[string]string{"alias": name}, fmt.Sprintf("Removed alias %s", name))
+		return nil
+	}
+
+	list, err := vehicles()
+	if err != nil {
+		return err
+	}
+	// remember the VINs for -vin completion, which must not call the API
+	vins := make([]string, 0, len(list))
+	for _, v := range list {
+		vins = append(vins, v.VIN)
+	}
+	if err := auth.SaveAccountVins(vins); err != nil {
+		log.Printf("Couldn't save the vehicle list for completion: %s", err)
+	}
+	defaultVIN, _ := auth.GetVin()
+	for i := range list {
+		for alias, vin := range aliases {
+			if strings.EqualFold(vin, list[i].VIN) {
+				list[i].Aliases = append(list[i].Aliases, alias)
+			}
+		}
+		sort.Strings(list[i].Aliases)
+		list[i].Default = strings.EqualFold(list[i].VIN, defaultVIN)
+	}
+	respond(ctx, list, vehiclesText(list))
+	return nil
+}
+
+func vehiclesText(list []vehicleSummary) string {
+	if len(list) == 0 {
+		return "No vehicles on this account"
+	}
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tVIN\tNAME\tMODEL\tSTATE\tALIASES")
+	for _, v := range list {
+		marker := ""
+		if v.Default {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", marker, v.VIN, v.DisplayName, v.Model, v.State, strings.Join(v.Aliases, ","))
+	}
+	w.Flush()
+	return strings.TrimRight(buf.String(), "\n")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveVehicle(t *testing.T) {
+	aliases := map[string]string{"blue-y": "7SAYGDEE1PA000001"}
+	fetched := false
+	vehicles := func() ([]vehicleSummary, error) {
+		fetched = true
+		return []vehicleSummary{
+			{VIN: "5YJ3E1EA7KF123456", DisplayName: "Red Rocket"},
+			{VIN: "LRW3E7FA9MC000002", DisplayName: "Twin"},
+			{VIN: "LRW3E7FA9MC000003", DisplayName: "twin"},
+		}, nil
+	}
+
+	testCases := []struct {
+		name     string
+		expected string
+		fetch    bool
+	}{
+		{name: "blue-y", expected: "7SAYGDEE1PA000001"},
+		{name: "5yj3e1ea7kf123456", expected: "5YJ3E1EA7KF123456"},
+		{name: "red rocket", expected: "5YJ3E1EA7KF123456", fetch: true},
+	}
+	for _, test := range testCases {
+		fetched = false
+		vin, err := resolveVehicle(test.name, aliases, vehicles)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		} else if vin != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.name, vin, test.expected)
+		}
+		if fetched != test.fetch {
+			t.Errorf("%s: fetched vehicle list = %t", test.name, fetched)
+		}
+	}
+
+	for _, name := range []string{"twin", "green"} {
+		if _, err := resolveVehicle(name, aliases, vehicles); !errors.Is(err, ErrCommandLineArgs) {
+			t.Errorf("%s: expected ErrCommandLineArgs, got %v", name, err)
+		}
+	}
+}
+
+func TestModelName(t *testing.T) {
+	for vin, model := range map[string]string{
+		"5YJ3E1EA7KF123456": "Model 3",
+		"7SAYGDEE1PA000001": "Model Y",
+		"5YJSA1E2XGF000000": "Model S",
+		"7G2CEHED0RA000000": "Cybertruck",
+		"":                  "unknown",
+	} {
+		if got := modelName(vin); got != model {
+			t.Errorf("%s: got %s, expected %s", vin, got, model)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// Outcomes of reading back the vehicle state with -verify.
+const (
+	verifyConfirmed    = "confirmed"
+	verifyNotConfirmed = "not_confirmed"
+	verifyUnknown      = "unknown" // the state could not be read
+)
+
+// Times an unconfirmed idempotent command is sent again with -verify.
+const verifyRetries = 2
+
+// Time the vehicle is given to act on a command before its state is read back.
+const verifyDelay = 2 * time.Second
+
+var ErrNotConfirmed = errors.New("vehicle state does not reflect the command")
+
+// Read back the state changed by each command, set with -verify.
+var verifyMode bool
+
+// verifier checks that a command took effect by reading back the state category it changes.
+type verifier struct {
+	category vehicle.StateCategory
+	check    func(data *carserver.VehicleData, args map[string]string) bool
+}
+
+var verifiers = map[string]verifier{
+	"lock": {vehicle.StateCategoryClosures, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return d.GetClosuresState().GetLocked()
+	}},
+	"unlock": {vehicle.StateCategoryClosures, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return !d.GetClosuresState().GetLocked()
+	}},
+	"trunk-open": {vehicle.StateCategoryClosures, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return d.GetClosuresState().GetDoorOpenTrunkRear()
+	}},
+	"trunk-close": {vehicle.StateCategoryClosures, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return !d.GetClosuresState().GetDoorOpenTrunkRear()
+	}},
+	"frunk-open": {vehicle.StateCategoryClosures, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return d.GetClosuresState().GetDoorOpenTrunkFront()
+	}},
+	"charging-start": {vehicle.StateCategoryCharge, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return isCharging(d)
+	}},
+	"charging-stop": {vehicle.StateCategoryCharge, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return !isCharging(d)
+	}},
+	"charging-set-limit": {vehicle.StateCategoryCharge, func(d *carserver.VehicleData, args map[string]string) bool {
+		return strconv.Itoa(int(d.GetChargeState().GetChargeLimitSoc())) == args["PERCENT"]
+	}},
+	"charging-set-amps": {vehicle.StateCategoryCharge, func(d *carserver.VehicleData, args map[string]string) bool {
+		return strconv.Itoa(int(d.GetChargeState().GetChargeCurrentRequest())) == args["AMPS"]
+	}},
+	"charge-port-open": {vehicle.StateCategoryCharge, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return d.GetChargeState().GetChargePortDoorOpen()
+	}},
+	"charge-port-close": {vehicle.StateCategoryCharge, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return !d.GetChargeState().GetChargePortDoorOpen()
+	}},
+	"climate-on": {vehicle.StateCategoryClimate, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return d.GetClimateState().GetIsClimateOn()
+	}},
+	"climate-off": {vehicle.StateCategoryClimate, func(d *carserver.VehicleData, _ map[string]string) bool {
+		return !d.GetClimateState().GetIsClimateOn()
+	}},
+	"climate-set-temp": {vehicle.StateCategoryClimate, func(d *carserver.VehicleData, args map[string]string) bool {
+		degrees, err := parseTemp(args["TEMP"])
+		// the vehicle rounds to its own steps, half a degree Celsius apart
+		return err == nil && math.Abs(float64(d.GetClimateState().GetDriverTempSetting()-degrees)) <= 0.25
+	}},
+}
+
+// Commands that verify never sends again, even if they are marked idempotent. The vehicle handles
+// them as a toggling move, so a second send after a first one that was merely slow reverses it.
+var closureToggles = map[string]bool{"trunk-open": true, "frunk-open": true, "trunk-move": true}
+
+// resendable reports whether verify may send an unconfirmed command again.
+func resendable(name string) bool {
+	return commands[name].idempotent && !closureToggles[name]
+}
+
+func isCharging(d *carserver.VehicleData) bool {
+	state := d.GetChargeState().GetChargingState()
+	return state.GetCharging() != nil || state.GetStarting() != nil
+}
+
+// verify reads back the state changed by the command in args, which returned err, and records the
+// outcome in r. A command that may have succeeded is confirmed or refuted by the readback. An
+// unconfirmed command is sent again up to verifyRetries times if it is resendable. Each command and each
+// readback gets its own timeout.
+func (r *Result) verify(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args []string, timeout time.Duration, err error) error {
+	v, ok := verifiers[args[0]]
+	if !ok || (err != nil && !protocol.MayHaveSucceeded(err)) {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(verifyDelay):
+		}
+
+		var data *carserver.VehicleData
+		readErr := withTimeout(ctx, timeout, func(ctx context.Context) (err error) {
+			data, err = car.GetState(ctx, v.category)
+			return err
+		})
+		switch {
+		case readErr != nil:
+			r.Verification = verifyUnknown
+			log.Printf("Couldn't read back vehicle state: %s", readErr)
+			return err
+		case v.check(data, r.Args):
+			r.Verification = verifyConfirmed
+			return nil
+		}
+
+		r.Verification = verifyNotConfirmed
+		err = ErrNotConfirmed
+		if !resendable(args[0]) || attempt == verifyRetries {
+			return err
+		}
+		log.Printf("%s not confirmed, sending it again", args[0])
+		if err = r.send(ctx, acct, car, args, timeout); err != nil && !protocol.MayHaveSucceeded(err) {
+			return err
+		}
+	}
+}
+
+// withTimeout calls f with ctx limited to timeout; zero means no limit.
+func withTimeout(ctx context.Context, timeout time.Duration, f func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return f(ctx)
+}
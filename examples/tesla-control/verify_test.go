@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestVerifiers(t *testing.T) {
+	charging := &carserver.ChargeState_ChargingState{Type: &carserver.ChargeState_ChargingState_Charging{Charging: &carserver.Void{}}}
+	data := &carserver.VehicleData{
+		ClosuresState: &carserver.ClosuresState{OptionalLocked: &carserver.ClosuresState_Locked{Locked: true}},
+		ChargeState: &carserver.ChargeState{
+			ChargingState:          charging,
+			OptionalChargeLimitSoc: &carserver.ChargeState_ChargeLimitSoc{ChargeLimitSoc: 80},
+		},
+		ClimateState: &carserver.ClimateState{OptionalDriverTempSetting: &carserver.ClimateState_DriverTempSetting{DriverTempSetting: 22}},
+	}
+	testCases := []struct {
+		command  string
+		args     map[string]string
+		expected bool
+	}{
+		{"lock", nil, true},
+		{"unlock", nil, false},
+		{"charging-start", nil, true},
+		{"charging-stop", nil, false},
+		{"charging-set-limit", map[string]string{"PERCENT": "80"}, true},
+		{"charging-set-limit", map[string]string{"PERCENT": "90"}, false},
+		{"climate-set-temp", map[string]string{"TEMP": "22C"}, true},
+		{"climate-set-temp", map[string]string{"TEMP": "72F"}, true},
+		{"climate-set-temp", map[string]string{"TEMP": "25C"}, false},
+		{"climate-on", nil, false},
+	}
+	for _, test := range testCases {
+		v, ok := verifiers[test.command]
+		if !ok {
+			t.Errorf("%s: no verifier", test.command)
+			continue
+		}
+		if confirmed := v.check(data, test.args); confirmed != test.expected {
+			t.Errorf("%s %v: got %t, expected %t", test.command, test.args, confirmed, test.expected)
+		}
+	}
+	for name := range verifiers {
+		if _, ok := commands[name]; !ok {
+			t.Errorf("verifier for unknown command %s", name)
+		}
+	}
+}
+
+func TestResendable(t *testing.T) {
+	for _, name := range []string{"lock", "trunk-close", "charging-set-limit", "climate-on"} {
+		if !resendable(name) {
+			t.Errorf("%s should be resent when unconfirmed", name)
+		}
+	}
+	for _, name := range []string{"trunk-open", "frunk-open", "trunk-move", "honk"} {
+		if resendable(name) {
+			t.Errorf("%s must not be resent when unconfirmed", name)
+		}
+	}
+
+	// even if a toggle were marked idempotent, verify would not send it again
+	info := commands["trunk-open"]
+	defer func(idempotent bool) { info.idempotent = idempotent }(info.idempotent)
+	info.idempotent = true
+	if resendable("trunk-open") {
+		t.Error("trunk-open is resent when marked idempotent")
+	}
+}
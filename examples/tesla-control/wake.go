@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/inindev/tesla_utils/auth"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+)
+
+// Longest delay between two checks of the vehicle state while waiting for it to come online.
+const maxWakeBackoff = 15 * time.Second
+
+// Vehicle state reported by the Fleet API once the vehicle accepts commands.
+const stateOnline = "online"
+
+var ErrVehicleAsleep = errors.New("vehicle is not online")
+
+// Wake policy of commands that need the vehicle online, set with -allow-wake, -wake-timeout,
+// -wake-backoff and -wake-jitter. Defaults to TESLA_WAKE from the profile.
+var wakePolicy = auth.DefaultWakePolicy()
+
+// profileWakePolicy returns the wake policy from the environment or config file.
+func profileWakePolicy() auth.WakePolicy {
+	policy, err := auth.GetWakePolicy()
+	if err != nil {
+		log.Printf("Ignoring wake policy: %s", err)
+	}
+	return policy
+}
+
+// vehicleState returns the state of vin in the Fleet API vehicle summary: online, asleep or
+// offline. Reading it does not wake the vehicle.
+func vehicleState(ctx context.Context, acct *account.Account, vin string) (string, error) {
+	reply, err := acct.Get(ctx, "api/1/vehicles/"+vin)
+	if err != nil {
+		return "", err
+	}
+	var summary struct {
+		Response struct {
+			State string `json:"state"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(reply, &summary); err != nil {
+		return "", fmt.Errorf("failed to parse vehicle summary: %w", err)
+	}
+	return summary.Response.State, nil
+}
+
+// waitOnline returns once state reports the vehicle online. If it is not, and the policy allows
+// waking, wake is called once and state is checked again after each delay until policy.MaxWait
+// has passed. The delay starts at policy.Backoff and doubles up to maxWakeBackoff, each one
+// randomized by policy.Jitter. progress is called with the state after each check that finds the
+// vehicle still not online.
+func waitOnline(ctx context.Context, policy auth.WakePolicy, state func(context.Context) (string, error), wake func(context.Context) error, progress func(state string, waited time.Duration)) error {
+	current, err := state(ctx)
+	if err != nil {
+		return fmt.Errorf("Error reading vehicle state: %w", err)
+	}
+	if current == stateOnline {
+		return nil
+	}
+	if !policy.Allow {
+		return fmt.Errorf("%w (%s) and waking it is not allowed", ErrVehicleAsleep, current)
+	}
+	if err := wake(ctx); err != nil {
+		return fmt.Errorf("Error waking vehicle: %w", err)
+	}
+
+	start := time.Now()
+	delay := policy.Backoff
+	for {
+		wait := jitter(delay, policy.Jitter)
+		if remaining := policy.MaxWait - time.Since(start); wait > remaining {
+			wait = remaining
+		}
+		if wait <= 0 {
+			return fmt.Errorf("%w (%s) after waiting %s", ErrVehicleAsleep, current, policy.MaxWait)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Waiting for vehicle to come online: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+
+		if current, err = state(ctx); err != nil {
+			return fmt.Errorf("Error reading vehicle state: %w", err)
+		}
+		if current == stateOnline {
+			return nil
+		}
+		progress(current, time.Since(start))
+		if delay *= 2; delay > maxWakeBackoff {
+			delay = maxWakeBackoff
+		}
+	}
+}
+
+// jitter randomizes delay by up to fraction of it in either direction.
+func jitter(delay time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return delay
+	}
+	return delay + time.Duration(float64(delay)*fraction*(2*rand.Float64()-1))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/inindev/tesla_utils/auth"
+)
+
+func TestWaitOnline(t *testing.T) {
+	policy := auth.WakePolicy{Allow: true, MaxWait: 200 * time.Millisecond, Backoff: time.Millisecond, Jitter: 0.5}
+	testCases := []struct {
+		name     string
+		states   []string
+		allow    bool
+		wakes    int
+		progress int
+		err      error
+	}{
+		{name: "online", states: []string{"online"}, allow: true},
+		{name: "asleep", states: []string{"asleep", "asleep", "offline", "online"}, allow: true, wakes: 1, progress: 2},
+		{name: "not allowed", states: []string{"asleep"}, err: ErrVehicleAsleep},
+		{name: "never online", states: []string{"asleep"}, allow: true, wakes: 1, err: ErrVehicleAsleep},
+	}
+	for _, test := range testCases {
+		checks, wakes, progress := 0, 0, 0
+		state := func(context.Context) (string, error) {
+			s := test.states[min(checks, len(test.states)-1)]
+			checks++
+			return s, nil
+		}
+		wake := func(context.Context) error {
+			wakes++
+			return nil
+		}
+		p := policy
+		p.Allow = test.allow
+		err := waitOnline(context.Background(), p, state, wake, func(string, time.Duration) { progress++ })
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, expected %v", test.name, err, test.err)
+		}
+		if wakes != test.wakes {
+			t.Errorf("%s: woke %d times, expected %d", test.name, wakes, test.wakes)
+		}
+		if test.err == nil && progress != test.progress {
+			t.Errorf("%s: reported progress %d times, expected %d", test.name, progress, test.progress)
+		}
+	}
+}
+
+func TestWaitOnlineDeadline(t *testing.T) {
+	policy := auth.WakePolicy{Allow: true, MaxWait: 50 * time.Millisecond, Backoff: 5 * time.Millisecond}
+	checks := 0
+	asleep := func(context.Context) (string, error) {
+		checks++
+		return "asleep", nil
+	}
+	wake := func(context.Context) error { return nil }
+	progress := func(string, time.Duration) {}
+
+	// the vehicle stays asleep past policy.MaxWait
+	start := time.Now()
+	err := waitOnline(context.Background(), policy, asleep, wake, progress)
+	if !errors.Is(err, ErrVehicleAsleep) {
+		t.Fatalf("got error %v, expected %v", err, ErrVehicleAsleep)
+	}
+	if waited := time.Since(start); waited < policy.MaxWait {
+		t.Errorf("gave up after %s, expected at least %s", waited, policy.MaxWait)
+	}
+	if checks < 3 {
+		t.Errorf("checked the state %d times, expected repeated checks", checks)
+	}
+	if c := classify(err); c.name != "vehicle_asleep" || c.exit != 12 {
+		t.Errorf("classified as %s (%d), expected vehicle_asleep (12)", c.name, c.exit)
+	}
+
+	// the command deadline passes before policy.MaxWait
+	policy.MaxWait = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = waitOnline(ctx, policy, asleep, wake, progress)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if c := classify(err); c.name != "timeout" || c.exit != 15 {
+		t.Errorf("classified as %s (%d), expected timeout (15)", c.name, c.exit)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(time.Second, 0.2); d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("jitter out of range: %s", d)
+		}
+	}
+	if d := jitter(time.Second, 0); d != time.Second {
+		t.Errorf("got %s without jitter", d)
+	}
+}
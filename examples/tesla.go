@@ -4,9 +4,13 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -15,6 +19,7 @@ import (
 	"github.com/teslamotors/vehicle-command/pkg/account"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+	"golang.org/x/term"
 )
 
 // exit codes
@@ -137,6 +142,11 @@ func authenticate() (auth.AuthData, error) {
 		}
 
 		fmt.Printf("\n%s\n%s\n%s\n\n", state, strings.Repeat("~", len(state)), oauthURL)
+		if auth.QRRequested() {
+			if code, err := auth.RenderQR(oauthURL); err == nil {
+				fmt.Println(code)
+			}
+		}
 
 		var authCode string
 		fmt.Print("enter the authorization code from the Tesla authentication page: ")
@@ -180,6 +190,244 @@ func refreshToken(refreshToken string) (auth.AuthData, error) {
 	return newAuth, nil
 }
 
+// read a passphrase from the environment or prompt for it without echo
+func readPassphrase(prompt string, confirm bool) (string, error) {
+	if pass := os.Getenv("TESLA_BUNDLE_PASSPHRASE"); pass != "" {
+		return pass, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("no terminal for passphrase prompt, set TESLA_BUNDLE_PASSPHRASE")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "confirm passphrase: ")
+		again, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if string(pass) != string(again) {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return string(pass), nil
+}
+
+// create path with owner-only permissions, never replacing an existing file, and remove it again if the write fails
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle file: %w", err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write bundle file: %w", err)
+	}
+	return nil
+}
+
+// config export [-o FILE] | config import [-force] FILE | config migrate [-dry-run]
+func configCommand(params []string) error {
+	if len(params) == 0 {
+		return errors.New("usage: config <export|import|migrate> [options]")
+	}
+
+	switch params[0] {
+	case "export":
+		fs := flag.NewFlagSet("config export", flag.ContinueOnError)
+		outFile := fs.String("o", "", "write the bundle to FILE instead of stdout")
+		if err := fs.Parse(params[1:]); err != nil {
+			return err
+		}
+
+		pass, err := readPassphrase("bundle passphrase: ", true)
+		if err != nil {
+			return err
+		}
+
+		// export into memory first so a failed export leaves no partial bundle behind
+		var bundle bytes.Buffer
+		files, err := auth.ExportBundle(&bundle, pass)
+		if err != nil {
+			return err
+		}
+
+		if *outFile == "" {
+			if _, err := bundle.WriteTo(os.Stdout); err != nil {
+				return fmt.Errorf("failed to write bundle: %w", err)
+			}
+		} else if err := writeNewFile(*outFile, bundle.Bytes()); err != nil {
+			return err
+		}
+		for _, f := range files {
+			log.Printf("exported %s", f.Path)
+		}
+		return nil
+
+	case "import":
+		fs := flag.NewFlagSet("config import", flag.ContinueOnError)
+		force := fs.Bool("force", false, "overwrite existing files")
+		if err := fs.Parse(params[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New("usage: config import [-force] FILE")
+		}
+
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("failed to open bundle file: %w", err)
+		}
+		defer f.Close()
+
+		pass, err := readPassphrase("bundle passphrase: ", false)
+		if err != nil {
+			return err
+		}
+
+		files, err := auth.ImportBundle(f, pass, *force)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			log.Printf("restored %s", f.Path)
+		}
+		return nil
+
+	case "migrate":
+		fs := flag.NewFlagSet("config migrate", flag.ContinueOnError)
+		dryRun := fs.Bool("dry-run", false, "show what would change without writing any files")
+		if err := fs.Parse(params[1:]); err != nil {
+			return err
+		}
+
+		results, err := auth.MigrateAll(*dryRun)
+		for _, r := range results {
+			if r.Missing {
+				fmt.Printf("%s: not found\n", r.Path)
+				continue
+			}
+			if !r.Changed() {
+				fmt.Printf("%s: up to date (version %d)\n", r.Path, r.To)
+				continue
+			}
+			fmt.Printf("%s: version %d -> %d\n", r.Path, r.From, r.To)
+			for _, change := range r.Changes {
+				fmt.Printf("  %s\n", change)
+			}
+			if r.Backup != "" {
+				fmt.Printf("  backup: %s\n", r.Backup)
+			}
+		}
+		return err
+	}
+	return fmt.Errorf("unknown config command: %s", params[0])
+}
+
+// partner token | partner public-key [-o DIR] [-serve ADDR] | partner register [-domain D] | partner verify [-domain D]
+func partnerCommand(params []string) error {
+	if len(params) == 0 {
+		return errors.New("usage: partner <token|public-key|register|verify> [options]")
+	}
+
+	fs := flag.NewFlagSet("partner "+params[0], flag.ContinueOnError)
+	domain := fs.String("domain", "", "app domain (defaults to TESLA_APP_DOMAIN or the redirect uri host)")
+	webRoot := fs.String("o", "", "write the public key below this web root at the well-known path")
+	serveAddr := fs.String("serve", "", "serve the public key on this address, e.g. :8080")
+	if err := fs.Parse(params[1:]); err != nil {
+		return err
+	}
+
+	switch params[0] {
+	case "token":
+		partner, err := auth.GetPartnerToken()
+		if err != nil {
+			return err
+		}
+		fmt.Println(partner.AccessToken)
+		return nil
+
+	case "public-key":
+		switch {
+		case *webRoot != "":
+			path, err := auth.WritePublicKeyFile(*webRoot)
+			if err != nil {
+				return err
+			}
+			log.Printf("wrote %s", path)
+		case *serveAddr != "":
+			handler, err := auth.PublicKeyHandler()
+			if err != nil {
+				return err
+			}
+			log.Printf("serving %s on %s", auth.PublicKeyWellKnownPath, *serveAddr)
+			return http.ListenAndServe(*serveAddr, handler)
+		default:
+			pemBytes, err := auth.AppPublicKeyPEM()
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(pemBytes))
+		}
+		return nil
+
+	case "register":
+		if *domain == "" {
+			var err error
+			if *domain, err = auth.GetAppDomain(); err != nil {
+				return err
+			}
+		}
+		partner, err := auth.GetPartnerToken()
+		if err != nil {
+			return err
+		}
+		if err := auth.RegisterPartnerAccount(partner.AccessToken, *domain); err != nil {
+			return fmt.Errorf("failed to register %s: %w", *domain, err)
+		}
+		log.Printf("registered %s", *domain)
+		return verifyPartnerKey(partner.AccessToken, *domain)
+
+	case "verify":
+		if *domain == "" {
+			var err error
+			if *domain, err = auth.GetAppDomain(); err != nil {
+				return err
+			}
+		}
+		partner, err := auth.GetPartnerToken()
+		if err != nil {
+			return err
+		}
+		return verifyPartnerKey(partner.AccessToken, *domain)
+	}
+	return fmt.Errorf("unknown partner command: %s", params[0])
+}
+
+// compare the key registered for domain with the local key
+func verifyPartnerKey(token, domain string) error {
+	match, err := auth.VerifyPartnerPublicKey(token, domain)
+	if err != nil {
+		return fmt.Errorf("failed to read back registered public key: %w", err)
+	}
+	if !match {
+		return fmt.Errorf("public key registered for %s does not match the configured key file", domain)
+	}
+	log.Printf("public key registered for %s matches the configured key file", domain)
+	return nil
+}
+
 func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -196,6 +444,19 @@ func main() {
 		Params: os.Args[2:],
 	}
 
+	// local configuration and partner commands do not need a vehicle or user token
+	if cmd.Name == "config" || cmd.Name == "partner" {
+		run := configCommand
+		if cmd.Name == "partner" {
+			run = partnerCommand
+		}
+		if err := run(cmd.Params); err != nil {
+			logger.Println(err)
+			os.Exit(exitError)
+		}
+		os.Exit(exitSuccess)
+	}
+
 	authData, err := authenticate()
 	if err != nil {
 		logger.Println(err)
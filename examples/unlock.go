@@ -129,6 +129,11 @@ func main() {
 			return
 		}
 		fmt.Printf("\n%s\n%s\n%s\n\n", state, strings.Repeat("~", len(state)), oauthUrl)
+		if auth.QRRequested() {
+			if code, err := auth.RenderQR(oauthUrl); err == nil {
+				fmt.Println(code)
+			}
+		}
 
 		// Wait for user to input the code after visiting the auth url
 		var authCode string
@@ -160,11 +165,17 @@ func main() {
 		return
 	}
 
-	car, err := acct.GetVehicle(ctx, vin, privateKey, nil)
+	// resume the sessions of an earlier run to skip the handshake
+	car, err := acct.GetVehicle(ctx, vin, privateKey, auth.LoadSessionCache())
 	if err != nil {
 		logger.Printf("failed to fetch vehicle info from account: %s", err)
 		return
 	}
+	defer func() {
+		if err := auth.SaveSessionCache(car); err != nil {
+			logger.Printf("failed to save session cache: %s", err)
+		}
+	}()
 
 	if err := lockUnlockCar(ctx, car, lock); err != nil {
 		return
@@ -2,10 +2,16 @@ module github.com/inindev/tesla_utils
 
 go 1.23.4
 
-require github.com/teslamotors/vehicle-command v0.3.0
+require (
+	github.com/teslamotors/vehicle-command v0.3.0
+	golang.org/x/crypto v0.32.0
+	golang.org/x/term v0.28.0
+	rsc.io/qr v0.2.0
+)
 
 require (
 	github.com/cronokirby/saferith v0.33.0 // indirect
 	github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
+	golang.org/x/sys v0.29.0 // indirect
 	google.golang.org/protobuf v1.36.3 // indirect
 )